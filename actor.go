@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+// Actor is party acting on behalf of the token subject, described by `act` claim (RFC 8693 section 4.1). Prior actors
+// of delegation chain are nested in `act` claim of the actor.
+type Actor struct {
+	// Subject is `sub` member of the actor.
+	Subject string
+
+	// Issuer is `iss` member of the actor. Empty when actor subject is issued by the token issuer.
+	Issuer string
+
+	// ClientID is `client_id` member of the actor.
+	ClientID string
+
+	// Claims are all members of the actor except nested `act` claim.
+	Claims jwt.MapClaims
+}
+
+// ActorChain returns delegation chain from token `act` claim, the current actor first and the earliest actor last.
+// Returns nil for token without `act` claim and an error when `act` claim or one of its nested `act` claims is not
+// an object.
+func ActorChain(claims jwt.Claims) ([]Actor, error) {
+	m, err := claimsToMap(claims)
+	if err != nil {
+		return nil, err
+	}
+	return actorChain(m)
+}
+
+func actorChain(claims map[string]interface{}) ([]Actor, error) {
+	var chain []Actor
+	for {
+		v, ok := claims["act"]
+		if !ok {
+			return chain, nil
+		}
+		act, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("jwt act claim at depth %d is not an object", len(chain)+1)
+		}
+		actor := Actor{Claims: jwt.MapClaims{}}
+		for k, v := range act {
+			if k != "act" {
+				actor.Claims[k] = v
+			}
+		}
+		actor.Subject, _ = claimString(actor.Claims, "sub")
+		actor.Issuer, _ = claimString(actor.Claims, "iss")
+		actor.ClientID, _ = claimString(actor.Claims, "client_id")
+		chain = append(chain, actor)
+		claims = act
+	}
+}
+
+// DelegationConfig defines the config for delegation middleware. Delegation middleware limits delegation chain
+// (`act` claim, RFC 8693) of the token stored in context by JWT middleware. Tokens without `act` claim have empty
+// chain.
+//
+// Delegation middleware must be executed after JWT middleware.
+type DelegationConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// ContextKey is key where JWT middleware stored the token in context.
+	// Optional. Default value "user".
+	ContextKey string
+
+	// MaxDepth is maximum number of actors in delegation chain. Use 1 to allow only direct delegation.
+	// Optional. When zero depth is not limited. Either MaxDepth or Validator is required.
+	MaxDepth int
+
+	// Validator is called with delegation chain of the token and rejects the request by returning an error.
+	// Optional. Either MaxDepth or Validator is required.
+	Validator func(c *echo.Context, chain []Actor) error
+
+	// ErrorHandler defines a function which is executed when delegation chain is not allowed. Error is
+	// ErrDelegationNotAllowed wrapping the reason.
+	// Optional. Default behaviour is to return the error.
+	ErrorHandler func(c *echo.Context, err error) error
+}
+
+// ErrDelegationNotAllowed denotes an error raised when delegation chain of the token is not allowed
+var ErrDelegationNotAllowed = echo.NewHTTPError(http.StatusForbidden, "delegation not allowed")
+
+// MaxDelegationDepth returns delegation middleware allowing tokens with at most maxDepth actors in delegation chain.
+func MaxDelegationDepth(maxDepth int) echo.MiddlewareFunc {
+	return DelegationWithConfig(DelegationConfig{MaxDepth: maxDepth})
+}
+
+// DelegationWithConfig returns delegation middleware or panics if configuration is invalid.
+//
+// For token with delegation chain that is not allowed, middleware returns "403 - Forbidden" error.
+func DelegationWithConfig(config DelegationConfig) echo.MiddlewareFunc {
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		panic(err)
+	}
+	return mw
+}
+
+// ToMiddleware converts DelegationConfig to middleware or returns an error for invalid configuration
+func (config DelegationConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if config.MaxDepth < 0 {
+		return nil, errors.New("jwt delegation middleware max depth can not be negative")
+	}
+	if config.MaxDepth == 0 && config.Validator == nil {
+		return nil, errors.New("jwt delegation middleware requires max depth or validator")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			err := config.check(c)
+			if err == nil {
+				return next(c)
+			}
+			err = ErrDelegationNotAllowed.Wrap(err)
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(c, err)
+			}
+			return err
+		}
+	}, nil
+}
+
+func (config DelegationConfig) check(c *echo.Context) error {
+	token, err := tokenFromContext(c, config.ContextKey)
+	if err != nil {
+		return err
+	}
+	chain, err := ActorChain(token.Claims)
+	if err != nil {
+		return err
+	}
+	if config.MaxDepth > 0 && len(chain) > config.MaxDepth {
+		return fmt.Errorf("delegation depth %d exceeds max depth %d", len(chain), config.MaxDepth)
+	}
+	if config.Validator != nil {
+		return config.Validator(c, chain)
+	}
+	return nil
+}
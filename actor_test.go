@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActorChain(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		whenClaims  jwt.Claims
+		expect      []Actor
+		expectError string
+	}{
+		{
+			name:       "ok, without act claim",
+			whenClaims: jwt.MapClaims{"sub": "user"},
+		},
+		{
+			name: "ok, nested actors",
+			whenClaims: jwt.MapClaims{
+				"sub": "user",
+				"act": map[string]interface{}{
+					"sub":       "service-b",
+					"client_id": "svc-b",
+					"act":       map[string]interface{}{"sub": "service-a", "iss": "https://issuer.example.com"},
+				},
+			},
+			expect: []Actor{
+				{Subject: "service-b", ClientID: "svc-b", Claims: jwt.MapClaims{"sub": "service-b", "client_id": "svc-b"}},
+				{
+					Subject: "service-a",
+					Issuer:  "https://issuer.example.com",
+					Claims:  jwt.MapClaims{"sub": "service-a", "iss": "https://issuer.example.com"},
+				},
+			},
+		},
+		{
+			name: "ok, custom claims struct",
+			whenClaims: &struct {
+				jwt.RegisteredClaims
+				Act map[string]interface{} `json:"act"`
+			}{Act: map[string]interface{}{"sub": "service-a"}},
+			expect: []Actor{{Subject: "service-a", Claims: jwt.MapClaims{"sub": "service-a"}}},
+		},
+		{
+			name:        "nok, act is not an object",
+			whenClaims:  jwt.MapClaims{"act": "service-a"},
+			expectError: "jwt act claim at depth 1 is not an object",
+		},
+		{
+			name:        "nok, nested act is not an object",
+			whenClaims:  jwt.MapClaims{"act": map[string]interface{}{"sub": "service-a", "act": []interface{}{}}},
+			expectError: "jwt act claim at depth 2 is not an object",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chain, err := ActorChain(tc.whenClaims)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, chain)
+		})
+	}
+}
+
+func TestDelegationConfig_ToMiddleware(t *testing.T) {
+	twoActors := jwt.MapClaims{
+		"act": map[string]interface{}{"sub": "service-b", "act": map[string]interface{}{"sub": "service-a"}},
+	}
+
+	var testCases = []struct {
+		name        string
+		givenConfig DelegationConfig
+		whenClaims  jwt.Claims
+		expectError string
+	}{
+		{
+			name:        "ok, without delegation",
+			givenConfig: DelegationConfig{MaxDepth: 1},
+			whenClaims:  jwt.MapClaims{"sub": "user"},
+		},
+		{
+			name:        "ok, depth within limit",
+			givenConfig: DelegationConfig{MaxDepth: 2},
+			whenClaims:  twoActors,
+		},
+		{
+			name:        "nok, depth exceeds limit",
+			givenConfig: DelegationConfig{MaxDepth: 1},
+			whenClaims:  twoActors,
+			expectError: "code=403, message=delegation not allowed, err=delegation depth 2 exceeds max depth 1",
+		},
+		{
+			name: "nok, validator rejects",
+			givenConfig: DelegationConfig{Validator: func(c *echo.Context, chain []Actor) error {
+				if chain[len(chain)-1].Subject != "gateway" {
+					return errors.New("delegation must start at gateway")
+				}
+				return nil
+			}},
+			whenClaims:  twoActors,
+			expectError: "code=403, message=delegation not allowed, err=delegation must start at gateway",
+		},
+		{
+			name:        "nok, malformed act claim",
+			givenConfig: DelegationConfig{MaxDepth: 1},
+			whenClaims:  jwt.MapClaims{"act": true},
+			expectError: "code=403, message=delegation not allowed, err=jwt act claim at depth 1 is not an object",
+		},
+		{
+			name:        "nok, token missing from context",
+			givenConfig: DelegationConfig{MaxDepth: 1},
+			expectError: "code=403, message=delegation not allowed, err=jwt token missing from context",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := tc.givenConfig.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			if tc.whenClaims != nil {
+				c.Set("user", &jwt.Token{Claims: tc.whenClaims})
+			}
+
+			err = mw(func(c *echo.Context) error { return nil })(c)
+
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDelegationConfig_ToMiddleware_error(t *testing.T) {
+	_, err := DelegationConfig{}.ToMiddleware()
+	assert.EqualError(t, err, "jwt delegation middleware requires max depth or validator")
+
+	_, err = DelegationConfig{MaxDepth: -1}.ToMiddleware()
+	assert.EqualError(t, err, "jwt delegation middleware max depth can not be negative")
+
+	assert.Panics(t, func() { MaxDelegationDepth(0) })
+}
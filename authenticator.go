@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+// Authenticator authenticates request with a single authentication scheme. JWT Config implements it with
+// Config.ToAuthenticator, BasicAuthenticator and APIKeyAuthenticator implement HTTP Basic and API key schemes.
+type Authenticator interface {
+	// Authenticate returns principal of the request. Error matching ErrorKindMissing (errors.Is) means the request does
+	// not contain credentials of the scheme, any other error means credentials are present but invalid.
+	Authenticate(c *echo.Context) (*Principal, error)
+}
+
+// AuthenticatorFunc is function implementing Authenticator interface.
+type AuthenticatorFunc func(c *echo.Context) (*Principal, error)
+
+// Authenticate implements Authenticator interface.
+func (f AuthenticatorFunc) Authenticate(c *echo.Context) (*Principal, error) {
+	return f(c)
+}
+
+// AuthChainConfig defines the config for authentication chain middleware.
+type AuthChainConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Authenticators are tried in order until one of them succeeds. Principal returned by the first successful
+	// authenticator is stored in context under PrincipalContextKey.
+	// Required.
+	Authenticators []Authenticator
+
+	// Optional enables optional authentication. Request without credentials of any scheme continues to the handler
+	// with anonymous Principal, while request with invalid credentials is still rejected.
+	// Optional. Default value false.
+	Optional bool
+
+	// ErrorHandler defines a function which is executed when no authenticator succeeded. Error is the first invalid
+	// credentials error or, when no credentials were present, the last missing credentials error.
+	// Optional. Default behaviour is to return ErrCredentialsInvalid or ErrCredentialsMissing wrapping the error.
+	ErrorHandler func(c *echo.Context, err error) error
+}
+
+// ErrCredentialsMissing denotes an error raised when request does not contain credentials of any authentication scheme
+var ErrCredentialsMissing = echo.NewHTTPError(http.StatusUnauthorized, "missing credentials")
+
+// ErrCredentialsInvalid denotes an error raised when request credentials are invalid
+var ErrCredentialsInvalid = echo.NewHTTPError(http.StatusUnauthorized, "invalid credentials")
+
+// AuthChain returns middleware trying given authenticators in order until one of them succeeds or panics if
+// configuration is invalid.
+func AuthChain(authenticators ...Authenticator) echo.MiddlewareFunc {
+	return AuthChainWithConfig(AuthChainConfig{Authenticators: authenticators})
+}
+
+// AuthChainWithConfig returns authentication chain middleware or panics if configuration is invalid.
+//
+// For request without valid credentials, middleware returns "401 - Unauthorized" error.
+func AuthChainWithConfig(config AuthChainConfig) echo.MiddlewareFunc {
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		panic(err)
+	}
+	return mw
+}
+
+// ToMiddleware converts AuthChainConfig to middleware or returns an error for invalid configuration
+func (config AuthChainConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if len(config.Authenticators) == 0 {
+		return nil, errors.New("jwt auth chain middleware requires authenticators")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			var invalidErr error
+			var missingErr error = ErrorKindMissing
+			for _, a := range config.Authenticators {
+				principal, err := a.Authenticate(c)
+				if err == nil && principal != nil {
+					c.Set(PrincipalContextKey, principal)
+					return next(c)
+				}
+				switch {
+				case err == nil || errors.Is(err, ErrorKindMissing):
+					if err != nil {
+						missingErr = err
+					}
+				case invalidErr == nil:
+					invalidErr = err
+				}
+			}
+
+			if invalidErr == nil && config.Optional {
+				c.Set(PrincipalContextKey, newAnonymousPrincipal())
+				return next(c)
+			}
+			err := invalidErr
+			if err == nil {
+				err = missingErr
+			}
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(c, err)
+			}
+			if invalidErr != nil {
+				return ErrCredentialsInvalid.Wrap(err)
+			}
+			return ErrCredentialsMissing.Wrap(err)
+		}
+	}, nil
+}
+
+// errInvalidCredentials is returned by authenticators when validator did not return principal or error
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// BasicAuthenticator returns Authenticator for HTTP Basic authentication (RFC 7617). Validator returns principal for
+// valid username and password or an error. Principal Scheme defaults to AuthSchemeBasic.
+func BasicAuthenticator(validator func(c *echo.Context, username string, password string) (*Principal, error)) Authenticator {
+	return AuthenticatorFunc(func(c *echo.Context) (*Principal, error) {
+		auth := c.Request().Header.Get(echo.HeaderAuthorization)
+		if len(auth) < len("Basic ") || !strings.EqualFold(auth[:len("Basic ")], "Basic ") {
+			return nil, ErrorKindMissing
+		}
+		username, password, ok := c.Request().BasicAuth()
+		if !ok {
+			return nil, ErrorKindMalformed.Wrap(errors.New("invalid basic authorization header"))
+		}
+		return validatePrincipal(AuthSchemeBasic, func() (*Principal, error) {
+			return validator(c, username, password)
+		})
+	})
+}
+
+// APIKeyAuthenticator returns Authenticator for API keys extracted from the request with lookup in Config.TokenLookup
+// format, for example "header:X-API-Key" or "query:api_key". Validator returns principal for valid key or an error.
+// Principal Scheme defaults to AuthSchemeAPIKey.
+func APIKeyAuthenticator(lookup string, validator func(c *echo.Context, key string) (*Principal, error)) (Authenticator, error) {
+	extractors, err := createExtractors(lookup)
+	if err != nil {
+		return nil, err
+	}
+	if len(extractors) == 0 {
+		return nil, errors.New("jwt api key authenticator requires lookup")
+	}
+	return AuthenticatorFunc(func(c *echo.Context) (*Principal, error) {
+		var lastErr error = ErrorKindMissing
+		for _, extractor := range extractors {
+			keys, _, err := extractor(c)
+			if err != nil {
+				lastErr = ErrorKindMissing.Wrap(err)
+				continue
+			}
+			for _, key := range keys {
+				return validatePrincipal(AuthSchemeAPIKey, func() (*Principal, error) {
+					return validator(c, key)
+				})
+			}
+		}
+		return nil, lastErr
+	}), nil
+}
+
+// validatePrincipal calls validator and sets default scheme to returned principal.
+func validatePrincipal(scheme string, validator func() (*Principal, error)) (*Principal, error) {
+	principal, err := validator()
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, errInvalidCredentials
+	}
+	if principal.Scheme == "" {
+		principal.Scheme = scheme
+	}
+	return principal, nil
+}
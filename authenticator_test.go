@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAuthenticators(t *testing.T) []Authenticator {
+	jwtAuth, err := Config{SigningKey: jwttest.Key("HS256").PublicKey}.ToAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKeyAuth, err := APIKeyAuthenticator("header:X-API-Key", func(c *echo.Context, key string) (*Principal, error) {
+		if key != "valid-key" {
+			return nil, errors.New("unknown api key")
+		}
+		return &Principal{Subject: "service"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	basicAuth := BasicAuthenticator(func(c *echo.Context, username string, password string) (*Principal, error) {
+		if username != "joe" || password != "secret" {
+			return nil, nil
+		}
+		return &Principal{Subject: username}, nil
+	})
+	return []Authenticator{jwtAuth, apiKeyAuth, basicAuth}
+}
+
+func TestAuthChain(t *testing.T) {
+	validJWT := "Bearer " + jwttest.NewToken("HS256").MustSign(t)
+	expiredJWT := "Bearer " + jwttest.NewToken("HS256").Expired().MustSign(t)
+
+	var testCases = []struct {
+		name            string
+		givenOptional   bool
+		whenHeaders     map[string]string
+		expectPrincipal *Principal
+		expectToken     bool
+		expectError     string
+	}{
+		{
+			name:            "ok, jwt",
+			whenHeaders:     map[string]string{echo.HeaderAuthorization: validJWT},
+			expectPrincipal: &Principal{Scheme: AuthSchemeJWT, Subject: jwttest.DefaultSubject},
+			expectToken:     true,
+		},
+		{
+			name:            "ok, api key",
+			whenHeaders:     map[string]string{"X-API-Key": "valid-key"},
+			expectPrincipal: &Principal{Scheme: AuthSchemeAPIKey, Subject: "service"},
+		},
+		{
+			name:            "ok, basic",
+			whenHeaders:     map[string]string{echo.HeaderAuthorization: "Basic am9lOnNlY3JldA=="},
+			expectPrincipal: &Principal{Scheme: AuthSchemeBasic, Subject: "joe"},
+		},
+		{
+			name:            "ok, first success wins over invalid credentials",
+			whenHeaders:     map[string]string{echo.HeaderAuthorization: expiredJWT, "X-API-Key": "valid-key"},
+			expectPrincipal: &Principal{Scheme: AuthSchemeAPIKey, Subject: "service"},
+		},
+		{
+			name:            "ok, optional without credentials",
+			givenOptional:   true,
+			expectPrincipal: &Principal{Anonymous: true},
+		},
+		{
+			name:        "nok, missing credentials",
+			expectError: "code=401, message=missing credentials, err=jwt missing",
+		},
+		{
+			name:          "nok, optional with invalid credentials",
+			givenOptional: true,
+			whenHeaders:   map[string]string{"X-API-Key": "invalid-key"},
+			expectError:   "code=401, message=invalid credentials, err=unknown api key",
+		},
+		{
+			name:        "nok, invalid jwt",
+			whenHeaders: map[string]string{echo.HeaderAuthorization: expiredJWT},
+			expectError: "code=401, message=invalid credentials, err=token has invalid claims: token is expired",
+		},
+		{
+			name:        "nok, invalid basic password",
+			whenHeaders: map[string]string{echo.HeaderAuthorization: "Basic am9lOndyb25n"},
+			expectError: "code=401, message=invalid credentials, err=invalid credentials",
+		},
+		{
+			name:        "nok, malformed basic",
+			whenHeaders: map[string]string{echo.HeaderAuthorization: "Basic !!!"},
+			expectError: "code=401, message=invalid credentials, err=invalid basic authorization header",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := AuthChainConfig{Authenticators: testAuthenticators(t), Optional: tc.givenOptional}.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.whenHeaders {
+				req.Header.Set(k, v)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			var principal *Principal
+			err = mw(func(c *echo.Context) error {
+				principal = PrincipalFromContext(c)
+				return nil
+			})(c)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectPrincipal, principal)
+			assert.Equal(t, tc.expectToken, c.Get("user") != nil)
+		})
+	}
+}
+
+func TestAuthChainConfig_ErrorHandler(t *testing.T) {
+	var handlerErr error
+	mw := AuthChainWithConfig(AuthChainConfig{
+		Authenticators: testAuthenticators(t),
+		ErrorHandler: func(c *echo.Context, err error) error {
+			handlerErr = err
+			return echo.ErrForbidden
+		},
+	})
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	err := mw(func(c *echo.Context) error { return nil })(c)
+
+	assert.Equal(t, echo.ErrForbidden, err)
+	assert.True(t, errors.Is(handlerErr, ErrorKindMissing))
+}
+
+func TestAuthChainConfig_ToMiddleware_error(t *testing.T) {
+	_, err := AuthChainConfig{}.ToMiddleware()
+	assert.EqualError(t, err, "jwt auth chain middleware requires authenticators")
+
+	assert.Panics(t, func() { AuthChain() })
+}
+
+func TestConfig_ToAuthenticator(t *testing.T) {
+	a, err := Config{SigningKey: jwttest.Key("HS256").PublicKey}.ToAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	_, err = a.Authenticate(c)
+	assert.Equal(t, ErrorKindMissing, ErrorKindOf(err))
+	assert.True(t, errors.Is(err, ErrorKindMissing))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+jwttest.NewToken("HS256").WrongKeyID().SignWith(jwttest.Key("HS384")).MustSign(t))
+	c = echo.New().NewContext(req, httptest.NewRecorder())
+	_, err = a.Authenticate(c)
+	assert.Equal(t, ErrorKindBadSignature, ErrorKindOf(err))
+	assert.False(t, errors.Is(err, ErrorKindMissing))
+
+	_, err = Config{}.ToAuthenticator()
+	assert.EqualError(t, err, "jwt middleware requires signing key")
+}
+
+func TestAPIKeyAuthenticator_error(t *testing.T) {
+	validator := func(c *echo.Context, key string) (*Principal, error) { return nil, nil }
+
+	_, err := APIKeyAuthenticator("", validator)
+	assert.EqualError(t, err, "jwt api key authenticator requires lookup")
+
+	_, err = APIKeyAuthenticator("header", validator)
+	assert.EqualError(t, err, "extractor source for lookup could not be split into needed parts: header")
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache is size bounded cache evicting the least recently used entry when full. It is safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRUCache[K comparable, V any](size int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		size:    size,
+		order:   list.New(),
+		entries: map[K]*list.Element{},
+	}
+}
+
+// get returns value for the key and marks it as recently used.
+func (lc *lruCache[K, V]) get(key K) (V, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	el, ok := lc.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	lc.order.MoveToFront(el)
+	return el.Value.(*lruEntry[K, V]).value, true
+}
+
+// add stores value for the key unless the key already exists, evicting the least recently used entry when cache is
+// full. Returns value stored in cache for the key.
+func (lc *lruCache[K, V]) add(key K, value V) V {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if el, ok := lc.entries[key]; ok {
+		lc.order.MoveToFront(el)
+		return el.Value.(*lruEntry[K, V]).value
+	}
+	lc.push(key, value)
+	return value
+}
+
+// set stores value for the key replacing existing value, evicting the least recently used entry when cache is full.
+func (lc *lruCache[K, V]) set(key K, value V) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if el, ok := lc.entries[key]; ok {
+		el.Value.(*lruEntry[K, V]).value = value
+		lc.order.MoveToFront(el)
+		return
+	}
+	lc.push(key, value)
+}
+
+// push inserts new entry as the most recently used and evicts the least recently used entry when cache is full.
+func (lc *lruCache[K, V]) push(key K, value V) {
+	lc.entries[key] = lc.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if lc.order.Len() > lc.size {
+		oldest := lc.order.Back()
+		lc.order.Remove(oldest)
+		delete(lc.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// remove deletes the key from cache.
+func (lc *lruCache[K, V]) remove(key K) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if el, ok := lc.entries[key]; ok {
+		lc.order.Remove(el)
+		delete(lc.entries, key)
+	}
+}
+
+// len returns number of entries in cache.
+func (lc *lruCache[K, V]) len() int {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.order.Len()
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	lc := newLRUCache[string, int](2)
+
+	assert.Equal(t, 1, lc.add("a", 1))
+	assert.Equal(t, 2, lc.add("b", 2))
+	assert.Equal(t, 1, lc.add("a", 10)) // existing value is kept
+
+	v, ok := lc.get("a") // "b" becomes least recently used
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	assert.Equal(t, 3, lc.add("c", 3))
+	assert.Equal(t, 2, lc.len())
+
+	_, ok = lc.get("b")
+	assert.False(t, ok)
+	v, ok = lc.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+
+	lc.set("c", 30)
+	v, _ = lc.get("c")
+	assert.Equal(t, 30, v)
+
+	lc.remove("c")
+	_, ok = lc.get("c")
+	assert.False(t, ok)
+	assert.Equal(t, 1, lc.len())
+}
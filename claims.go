@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+// errTokenNotInContext is returned when middleware depending on JWT middleware can not find parsed token in context.
+var errTokenNotInContext = errors.New("jwt token missing from context")
+
+// tokenFromContext returns token stored by JWT middleware under given context key.
+func tokenFromContext(c *echo.Context, contextKey string) (*jwt.Token, error) {
+	token, ok := c.Get(contextKey).(*jwt.Token)
+	if !ok || token == nil {
+		return nil, errTokenNotInContext
+	}
+	return token, nil
+}
+
+// claimsToMap converts any claims type to jwt.MapClaims. Custom claims types are converted through JSON encoding, so
+// only fields declared on the struct are visible, under their JSON names. Claims of the token that the struct does
+// not declare are lost.
+func claimsToMap(claims jwt.Claims) (jwt.MapClaims, error) {
+	switch cl := claims.(type) {
+	case nil:
+		return jwt.MapClaims{}, nil
+	case jwt.MapClaims:
+		return cl, nil
+	case *jwt.MapClaims:
+		return *cl, nil
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	result := jwt.MapClaims{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// claimString returns claim value as string. ok is false when claim does not exist or is not a string.
+func claimString(claims jwt.MapClaims, name string) (string, bool) {
+	v, ok := claims[name].(string)
+	return v, ok
+}
+
+// claimStrings returns claim value as string slice. Claim can be single string or an array of strings.
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	return toStrings(claims[name])
+}
+
+func toStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// claimTime returns claim value (NumericDate, seconds since epoch) as time. ok is false when claim does not exist
+// or is not a number.
+func claimTime(claims jwt.MapClaims, name string) (time.Time, bool) {
+	var seconds float64
+	switch v := claims[name].(type) {
+	case float64:
+		seconds = v
+	case int64:
+		seconds = float64(v)
+	case int:
+		seconds = float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = f
+	default:
+		return time.Time{}, false
+	}
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, false
+	}
+	round, frac := math.Modf(seconds)
+	return time.Unix(int64(round), int64(frac*1e9)), true
+}
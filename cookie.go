@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+// DefaultCookieChunkSize is default maximum length of cookie value written by SetChunkedCookie. Browsers limit a
+// single cookie (name, value and attributes) to about 4096 bytes, the rest is left for name and attributes.
+const DefaultCookieChunkSize = 3800
+
+// maxCookieChunks limits number of chunks a token is split into and joined from. This limits possible resource
+// exhaustion attack vector
+const maxCookieChunks = 32
+
+// ValuesFromChunkedCookie returns a function that extracts token split into multiple cookies `<name>.0`, `<name>.1`,
+// ... and joins chunks back into single value. Chunks are read in order until first missing index. When there are no
+// chunks, value of cookie `<name>` is returned so tokens small enough to fit into one cookie can be read with the same
+// extractor.
+//
+// See SetChunkedCookie for the writing side.
+func ValuesFromChunkedCookie(name string) middleware.ValuesExtractor {
+	return func(c *echo.Context) ([]string, middleware.ExtractorSource, error) {
+		cookies := make(map[string]string)
+		for _, cookie := range c.Cookies() {
+			if _, ok := cookies[cookie.Name]; !ok {
+				cookies[cookie.Name] = cookie.Value
+			}
+		}
+
+		var sb strings.Builder
+		for i := 0; i < maxCookieChunks; i++ {
+			chunk, ok := cookies[cookieChunkName(name, i)]
+			if !ok {
+				break
+			}
+			sb.WriteString(chunk)
+		}
+		value := sb.String()
+		if value == "" {
+			value = cookies[name]
+		}
+		if value == "" {
+			return nil, ExtractorSourceChunkedCookie, errChunkedCookieValueMissing
+		}
+		return []string{value}, ExtractorSourceChunkedCookie, nil
+	}
+}
+
+// SetChunkedCookie writes cookie value split into cookies `<name>.0`, `<name>.1`, ... of at most chunkSize bytes
+// each. All chunks share attributes (Path, Domain, Expires, Secure, HttpOnly, SameSite etc.) of given cookie.
+// Chunks left over from previously written longer value and unchunked cookie `<name>` sent with the request are
+// expired so the browser does not send stale chunks with the next request.
+//
+// chunkSize <= 0 means DefaultCookieChunkSize.
+func SetChunkedCookie(c *echo.Context, cookie *http.Cookie, chunkSize int) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultCookieChunkSize
+	}
+	value := cookie.Value
+	count := (len(value) + chunkSize - 1) / chunkSize
+	if count > maxCookieChunks {
+		return fmt.Errorf("jwt cookie value is too long to be split into %d chunks", maxCookieChunks)
+	}
+	for i := 0; i < count; i++ {
+		end := min((i+1)*chunkSize, len(value))
+		chunk := *cookie
+		chunk.Name = cookieChunkName(cookie.Name, i)
+		chunk.Value = value[i*chunkSize : end]
+		c.SetCookie(&chunk)
+	}
+	clearCookieChunks(c, cookie, count)
+	return nil
+}
+
+// ClearChunkedCookie expires all chunks of the cookie and unchunked cookie `<name>` sent with the request. Path and
+// Domain of given cookie must match the ones used when cookie was set.
+func ClearChunkedCookie(c *echo.Context, cookie *http.Cookie) {
+	clearCookieChunks(c, cookie, 0)
+}
+
+// clearCookieChunks expires request cookies `<name>` and `<name>.<index>` with index >= from.
+func clearCookieChunks(c *echo.Context, cookie *http.Cookie, from int) {
+	for _, existing := range c.Cookies() {
+		if existing.Name != cookie.Name {
+			index, ok := strings.CutPrefix(existing.Name, cookie.Name+".")
+			if !ok {
+				continue
+			}
+			if i, err := strconv.Atoi(index); err != nil || i < from {
+				continue
+			}
+		}
+		expired := *cookie
+		expired.Name = existing.Name
+		expired.Value = ""
+		expired.MaxAge = -1
+		expired.Expires = time.Unix(0, 0)
+		c.SetCookie(&expired)
+	}
+}
+
+func cookieChunkName(name string, index int) string {
+	return name + "." + strconv.Itoa(index)
+}
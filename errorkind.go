@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrorKind classifies why token was rejected. Kinds are stable and independent of the underlying JWT library errors so
+// ErrorHandler can switch on them. ErrorKind implements error, so `errors.Is(err, ErrorKindExpired)` can be used with
+// errors returned by the middleware.
+type ErrorKind string
+
+const (
+	// ErrorKindInvalid is token rejected for any reason not covered by other kinds (invalid issuer, claims etc.)
+	ErrorKindInvalid ErrorKind = "invalid"
+	// ErrorKindMissing is token not found in the request
+	ErrorKindMissing ErrorKind = "missing"
+	// ErrorKindMalformed is token that could not be decoded
+	ErrorKindMalformed ErrorKind = "malformed"
+	// ErrorKindExpired is token with `exp` claim in the past
+	ErrorKindExpired ErrorKind = "expired"
+	// ErrorKindNotYetValid is token with `nbf` or `iat` claim in the future
+	ErrorKindNotYetValid ErrorKind = "not_yet_valid"
+	// ErrorKindBadSignature is token with signature not matching verification key
+	ErrorKindBadSignature ErrorKind = "bad_signature"
+	// ErrorKindUnknownKeyID is token signed with key that is not known or not active
+	ErrorKindUnknownKeyID ErrorKind = "unknown_key_id"
+	// ErrorKindAlgorithmNotAllowed is token signed with algorithm that is not allowed
+	ErrorKindAlgorithmNotAllowed ErrorKind = "algorithm_not_allowed"
+	// ErrorKindAudienceMismatch is token with `aud` claim not matching expected audience
+	ErrorKindAudienceMismatch ErrorKind = "audience_mismatch"
+	// ErrorKindRevoked is token that has been revoked
+	ErrorKindRevoked ErrorKind = "revoked"
+)
+
+func (k ErrorKind) Error() string { return "jwt " + string(k) }
+
+// Wrap returns error classified as this kind. Use it in custom KeyFunc or ParseTokenFunc implementations to report
+// kind of the failure, for example `ErrorKindRevoked.Wrap(err)`.
+func (k ErrorKind) Wrap(err error) error {
+	return &kindError{kind: k, err: err}
+}
+
+// kindError is error explicitly classified as ErrorKind.
+type kindError struct {
+	kind ErrorKind
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+func (e *kindError) Unwrap() error { return e.err }
+
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+// Kind returns kind of the token error.
+func (e *TokenError) Kind() ErrorKind {
+	kind := ErrorKindOf(e.Err)
+	if kind == ErrorKindInvalid && e.Token != nil && e.Token.Method == nil && errors.Is(e.Err, jwt.ErrTokenUnverifiable) {
+		// token `alg` header names algorithm that is not available at all
+		return ErrorKindAlgorithmNotAllowed
+	}
+	return kind
+}
+
+// Is checks if target is ErrorKind of the token error.
+func (e *TokenError) Is(target error) bool {
+	kind, ok := target.(ErrorKind)
+	return ok && e.Kind() == kind
+}
+
+// ErrorKindOf classifies error returned by the middleware, TokenError or error returned by the JWT library. Errors
+// explicitly classified with ErrorKind.Wrap take precedence. Unclassified errors are ErrorKindInvalid.
+func ErrorKindOf(err error) ErrorKind {
+	var kErr *kindError
+	if errors.As(err, &kErr) {
+		return kErr.kind
+	}
+	var tErr *TokenError
+	if errors.As(err, &tErr) {
+		return tErr.Kind()
+	}
+	var eErr *TokenExtractionError
+	if errors.As(err, &eErr) {
+		return ErrorKindMissing
+	}
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ErrorKindMalformed
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrorKindExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrorKindNotYetValid
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrSignatureInvalid):
+		return ErrorKindBadSignature
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrorKindAudienceMismatch
+	}
+	return ErrorKindInvalid
+}
+
+// errUnexpectedSigningMethod creates error for token signed with algorithm that is not allowed.
+func errUnexpectedSigningMethod(token *jwt.Token) error {
+	return ErrorKindAlgorithmNotAllowed.Wrap(fmt.Errorf("unexpected jwt signing method=%v", token.Header["alg"]))
+}
+
+// errUnexpectedKeyID creates error for token signed with unknown key.
+func errUnexpectedKeyID(token *jwt.Token) error {
+	return ErrorKindUnknownKeyID.Wrap(fmt.Errorf("unexpected jwt key id=%v", token.Header["kid"]))
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKindOf(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+	errRevoked := errors.New("token is revoked")
+
+	var testCases = []struct {
+		name        string
+		givenConfig Config
+		whenToken   string
+		expectKind  ErrorKind
+	}{
+		{
+			name:       "missing",
+			expectKind: ErrorKindMissing,
+		},
+		{
+			name:       "malformed",
+			whenToken:  "a.b.c",
+			expectKind: ErrorKindMalformed,
+		},
+		{
+			name:       "expired",
+			whenToken:  createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()}, nil),
+			expectKind: ErrorKindExpired,
+		},
+		{
+			name:       "not yet valid",
+			whenToken:  createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()}, nil),
+			expectKind: ErrorKindNotYetValid,
+		},
+		{
+			name:       "bad signature",
+			whenToken:  createToken(t, jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{}, nil),
+			expectKind: ErrorKindBadSignature,
+		},
+		{
+			name:        "unknown key id",
+			givenConfig: Config{SigningKeys: map[string]interface{}{"a": key}},
+			whenToken:   createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{}, map[string]interface{}{"kid": "b"}),
+			expectKind:  ErrorKindUnknownKeyID,
+		},
+		{
+			name: "unknown key id, key set key not active",
+			givenConfig: Config{KeySet: KeySet{
+				"a": {Key: key, NotBefore: now.Add(time.Hour)},
+			}},
+			whenToken:  createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{}, map[string]interface{}{"kid": "a"}),
+			expectKind: ErrorKindUnknownKeyID,
+		},
+		{
+			name:       "algorithm not allowed",
+			whenToken:  createToken(t, jwt.SigningMethodHS384, key, jwt.MapClaims{}, nil),
+			expectKind: ErrorKindAlgorithmNotAllowed,
+		},
+		{
+			name:       "algorithm not available",
+			whenToken:  "eyJhbGciOiJYWVoiLCJ0eXAiOiJKV1QifQ.e30.c2ln",
+			expectKind: ErrorKindAlgorithmNotAllowed,
+		},
+		{
+			name: "algorithm not allowed by issuer profile",
+			givenConfig: Config{Issuers: []IssuerProfile{
+				{Issuer: "iss", SigningKey: key, SigningMethods: []string{AlgorithmHS256}, KeyFunc: func(token *jwt.Token) (interface{}, error) {
+					return key, nil
+				}},
+			}},
+			whenToken:  createToken(t, jwt.SigningMethodHS384, key, jwt.MapClaims{"iss": "iss"}, nil),
+			expectKind: ErrorKindAlgorithmNotAllowed,
+		},
+		{
+			name: "audience mismatch",
+			givenConfig: Config{Issuers: []IssuerProfile{
+				{Issuer: "iss", SigningKey: key, Audience: []string{"api"}},
+			}},
+			whenToken:  createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{"iss": "iss", "aud": "other"}, nil),
+			expectKind: ErrorKindAudienceMismatch,
+		},
+		{
+			name: "revoked",
+			givenConfig: Config{KeyFunc: func(token *jwt.Token) (interface{}, error) {
+				return nil, ErrorKindRevoked.Wrap(errRevoked)
+			}},
+			whenToken:  createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{}, nil),
+			expectKind: ErrorKindRevoked,
+		},
+		{
+			name: "invalid",
+			givenConfig: Config{Issuers: []IssuerProfile{
+				{Issuer: "iss", SigningKey: key},
+			}},
+			whenToken:  createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{"iss": "other"}, nil),
+			expectKind: ErrorKindInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.givenConfig
+			if config.SigningKey == nil && config.SigningKeys == nil && config.KeySet == nil && config.KeyFunc == nil && config.Issuers == nil {
+				config.SigningKey = key
+			}
+			var handlerErr error
+			config.ErrorHandler = func(c *echo.Context, err error) error {
+				handlerErr = err
+				return err
+			}
+			mw, err := config.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.whenToken != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.whenToken)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			err = mw(func(c *echo.Context) error { return nil })(c)
+			assert.Error(t, err)
+			assert.Equal(t, tc.expectKind, ErrorKindOf(handlerErr))
+			assert.ErrorIs(t, handlerErr, tc.expectKind)
+		})
+	}
+}
+
+func TestTokenError_Kind(t *testing.T) {
+	err := &TokenError{Err: ErrorKindRevoked.Wrap(errors.New("token is revoked"))}
+
+	assert.Equal(t, ErrorKindRevoked, err.Kind())
+	assert.EqualError(t, err, "token is revoked")
+	assert.ErrorIs(t, err, ErrorKindRevoked)
+	assert.NotErrorIs(t, err, ErrorKindExpired)
+}
@@ -0,0 +1,429 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	// GrantTypeTokenExchange is OAuth 2.0 token exchange grant type (RFC 8693)
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// TokenTypeAccessToken is token type identifier of OAuth 2.0 access token (RFC 8693)
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// TokenTypeJWT is token type identifier of JWT (RFC 8693)
+	TokenTypeJWT = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchangeConfig defines the config for OAuth 2.0 token exchange handler (RFC 8693). Handler validates subject
+// token, identifies the actor and mints downscoped token for the subject with the actor recorded in `act` claim.
+// Actors recorded in `act` claim of the subject token are nested in the new `act` claim, so the minted token contains
+// the full delegation chain. When subject token is an impersonation token, minted token keeps the real user in
+// `impersonator` claim.
+//
+// Actor is subject of `actor_token` when request contains one, otherwise authenticated Principal stored in context,
+// i.e. the client authenticated by AuthChain in front of the handler. When there is no actor, minted token keeps `act`
+// claim of the subject token unchanged.
+type TokenExchangeConfig struct {
+	// SubjectToken is JWT middleware Config used to validate `subject_token`. Token is parsed with the same parse path
+	// as the middleware uses (ParseTokenFunc, KeyFunc, Issuers, TenantResolver...). TokenLookup is not used.
+	// Required.
+	SubjectToken Config
+
+	// ActorToken is JWT middleware Config used to validate `actor_token`.
+	// Optional. Default value SubjectToken.
+	ActorToken *Config
+
+	// SigningKey is private key (or secret for HMAC) minted tokens are signed with.
+	// Required.
+	SigningKey interface{}
+
+	// SigningMethod is algorithm minted tokens are signed with.
+	// Optional. Default value HS256.
+	SigningMethod string
+
+	// KeyID is `kid` header of minted tokens.
+	// Optional.
+	KeyID string
+
+	// Issuer is `iss` claim of minted tokens.
+	// Optional.
+	Issuer string
+
+	// TTL is lifetime of minted tokens. Minted token never outlives the subject token.
+	// Optional. Default value 5 minutes.
+	TTL time.Duration
+
+	// AllowedAudiences restricts `audience` and `resource` parameters. Minted token `aud` claim contains requested
+	// audiences or, when request does not contain audience, `aud` claim of the subject token.
+	// Optional. When empty requested audiences must be present in `aud` claim of the subject token.
+	AllowedAudiences []string
+
+	// CopyClaims are names of subject token claims copied to minted token, for example "tenant" or "email". Registered
+	// claims and `scope`, `act` and `impersonator` claims are never copied.
+	// Optional.
+	CopyClaims []string
+
+	// MaxDelegationDepth is maximum number of actors in delegation chain of minted token.
+	// Optional. When zero depth is not limited.
+	MaxDelegationDepth int
+
+	// Policy is called before token is minted and rejects the exchange by returning an error. Policy can modify claims
+	// of the token to be minted. TokenExchangeError returned by Policy is sent to the client as is, other errors are
+	// sent as `invalid_request` error with the error message as description.
+	// Optional.
+	Policy func(c *echo.Context, exchange *TokenExchange) error
+}
+
+// TokenExchange is token exchange request passed to TokenExchangeConfig.Policy.
+type TokenExchange struct {
+	// Subject are claims of validated subject token.
+	Subject jwt.MapClaims
+
+	// Actor are claims of validated actor token. Nil when request does not contain actor token.
+	Actor jwt.MapClaims
+
+	// Audience is requested audience.
+	Audience []string
+
+	// Scopes are requested scopes or scopes of the subject token when request does not contain `scope` parameter.
+	Scopes []string
+
+	// Actors is delegation chain of the token to be minted, the current actor first.
+	Actors []Actor
+
+	// Claims are claims of the token to be minted.
+	Claims jwt.MapClaims
+}
+
+// TokenExchangeResponse is successful token exchange response (RFC 8693 section 2.2.1).
+type TokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// TokenExchangeError is token exchange error response (RFC 8693 section 2.2.2, RFC 6749 section 5.2).
+type TokenExchangeError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Error returns error message.
+func (e *TokenExchangeError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// TokenExchangeHandler returns token exchange handler or panics if configuration is invalid.
+//
+// Handler expects form encoded token exchange request and responds with TokenExchangeResponse or
+// "400 - Bad Request" TokenExchangeError.
+func TokenExchangeHandler(config TokenExchangeConfig) echo.HandlerFunc {
+	h, err := config.ToHandler()
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// ToHandler converts TokenExchangeConfig to handler or returns an error for invalid configuration
+func (config TokenExchangeConfig) ToHandler() (echo.HandlerFunc, error) {
+	signer, err := newTokenSigner(config.SigningMethod, config.SigningKey, config.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("jwt token exchange %w", err)
+	}
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.MaxDelegationDepth < 0 {
+		return nil, errors.New("jwt token exchange max delegation depth can not be negative")
+	}
+	subject, err := config.SubjectToken.newAuthenticator()
+	if err != nil {
+		return nil, fmt.Errorf("jwt token exchange subject token config: %w", err)
+	}
+	actor := subject
+	if config.ActorToken != nil {
+		if actor, err = config.ActorToken.newAuthenticator(); err != nil {
+			return nil, fmt.Errorf("jwt token exchange actor token config: %w", err)
+		}
+	}
+
+	return func(c *echo.Context) error {
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		res, err := config.exchange(c, signer, subject, actor)
+		if err != nil {
+			var exchangeErr *TokenExchangeError
+			if errors.As(err, &exchangeErr) {
+				return c.JSON(http.StatusBadRequest, exchangeErr)
+			}
+			return err
+		}
+		return c.JSON(http.StatusOK, res)
+	}, nil
+}
+
+func (config TokenExchangeConfig) exchange(
+	c *echo.Context,
+	signer *tokenSigner,
+	subject *jwtAuthenticator,
+	actor *jwtAuthenticator,
+) (*TokenExchangeResponse, error) {
+	if c.FormValue("grant_type") != GrantTypeTokenExchange {
+		return nil, &TokenExchangeError{Code: "unsupported_grant_type"}
+	}
+	if t := c.FormValue("requested_token_type"); t != "" && t != TokenTypeAccessToken && t != TokenTypeJWT {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "unsupported requested_token_type"}
+	}
+	subjectClaims, subjectPrincipal, err := parseExchangeToken(c, subject, "subject_token")
+	if err != nil {
+		return nil, err
+	}
+	if subjectClaims == nil {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "subject_token is required"}
+	}
+	if sub, ok := claimString(subjectClaims, "sub"); !ok || sub == "" {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "subject_token is missing sub claim"}
+	}
+	actorClaims, _, err := parseExchangeToken(c, actor, "actor_token")
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := c.FormValues()
+	if err != nil {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "invalid form"}
+	}
+	subjectAudience := claimStrings(subjectClaims, "aud")
+	audience := slices.Concat(params["audience"], params["resource"])
+	allowedAudiences := config.AllowedAudiences
+	if len(allowedAudiences) == 0 {
+		allowedAudiences = subjectAudience
+	}
+	for _, aud := range audience {
+		if !slices.Contains(allowedAudiences, aud) {
+			return nil, &TokenExchangeError{Code: "invalid_target", Description: "audience is not allowed"}
+		}
+	}
+	if len(audience) == 0 {
+		audience = subjectAudience
+	}
+	scopes := tokenScopes(subjectClaims)
+	if scope := c.FormValue("scope"); scope != "" {
+		requested := strings.Fields(scope)
+		for _, s := range requested {
+			if !slices.Contains(scopes, s) {
+				return nil, &TokenExchangeError{Code: "invalid_scope", Description: "scope exceeds subject token scope"}
+			}
+		}
+		scopes = requested
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(config.TTL)
+	if exp, ok := claimTime(subjectClaims, "exp"); ok && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+	claims := jwt.MapClaims{
+		"sub": subjectClaims["sub"],
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
+		"jti": newTokenID(),
+	}
+	if config.Issuer != "" {
+		claims["iss"] = config.Issuer
+	}
+	if subjectPrincipal.IsImpersonated() {
+		claims[ImpersonatorClaim] = map[string]interface{}{"sub": subjectPrincipal.Impersonator}
+	}
+	if len(audience) > 0 {
+		claims["aud"] = audience
+	}
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	for _, name := range config.CopyClaims {
+		if v, ok := subjectClaims[name]; ok && !isExchangeReservedClaim(name) {
+			claims[name] = v
+		}
+	}
+	act, err := config.actClaim(c, subjectClaims, actorClaims)
+	if err != nil {
+		return nil, err
+	}
+	if act != nil {
+		claims["act"] = act
+	}
+	actors, err := actorChain(claims)
+	if err != nil {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "subject_token act claim is invalid"}
+	}
+	if config.MaxDelegationDepth > 0 && len(actors) > config.MaxDelegationDepth {
+		return nil, &TokenExchangeError{Code: "invalid_request", Description: "delegation depth exceeds allowed depth"}
+	}
+
+	if config.Policy != nil {
+		exchange := &TokenExchange{
+			Subject:  subjectClaims,
+			Actor:    actorClaims,
+			Audience: audience,
+			Scopes:   scopes,
+			Actors:   actors,
+			Claims:   claims,
+		}
+		if err := config.Policy(c, exchange); err != nil {
+			var exchangeErr *TokenExchangeError
+			if errors.As(err, &exchangeErr) {
+				return nil, exchangeErr
+			}
+			return nil, &TokenExchangeError{Code: "invalid_request", Description: err.Error()}
+		}
+	}
+
+	signed, err := signer.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	res := &TokenExchangeResponse{
+		AccessToken:     signed,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       expiresAt.Unix() - now.Unix(),
+	}
+	if len(scopes) > 0 {
+		res.Scope = strings.Join(scopes, " ")
+	}
+	return res, nil
+}
+
+// actClaim creates `act` claim for minted token with the current actor and actors of the subject token nested in it.
+func (config TokenExchangeConfig) actClaim(c *echo.Context, subjectClaims jwt.MapClaims, actorClaims jwt.MapClaims) (map[string]interface{}, error) {
+	act := map[string]interface{}{}
+	switch {
+	case actorClaims != nil:
+		sub, ok := claimString(actorClaims, "sub")
+		if !ok || sub == "" {
+			return nil, &TokenExchangeError{Code: "invalid_request", Description: "actor_token is missing sub claim"}
+		}
+		act["sub"] = sub
+		for _, name := range []string{"iss", "client_id"} {
+			if v, ok := claimString(actorClaims, name); ok && v != "" {
+				act[name] = v
+			}
+		}
+	case IsAuthenticated(c) && PrincipalFromContext(c).Subject != "":
+		act["sub"] = PrincipalFromContext(c).Subject
+	default:
+		if prior, ok := subjectClaims["act"].(map[string]interface{}); ok {
+			return prior, nil
+		}
+		return nil, nil
+	}
+	if prior, ok := subjectClaims["act"]; ok {
+		act["act"] = prior
+	}
+	return act, nil
+}
+
+// parseExchangeToken validates token from form parameter with the authenticator parse path and returns its claims and
+// principal. Returns nil claims when parameter is empty.
+func parseExchangeToken(c *echo.Context, a *jwtAuthenticator, param string) (jwt.MapClaims, *Principal, error) {
+	raw := c.FormValue(param)
+	if raw == "" {
+		return nil, nil, nil
+	}
+	if t := c.FormValue(param + "_type"); t != TokenTypeAccessToken && t != TokenTypeJWT {
+		return nil, nil, &TokenExchangeError{Code: "invalid_request", Description: "unsupported " + param + "_type"}
+	}
+	parseToken, _ := a.routePolicy(c)
+	parsed, principal, err := a.parse(c, parseToken, raw)
+	if err != nil {
+		return nil, nil, &TokenExchangeError{Code: "invalid_request", Description: param + " is invalid"}
+	}
+	token, ok := parsed.(*jwt.Token)
+	if !ok {
+		return nil, nil, &TokenExchangeError{Code: "invalid_request", Description: param + " is invalid"}
+	}
+	claims, err := claimsToMap(token.Claims)
+	if err != nil {
+		return nil, nil, &TokenExchangeError{Code: "invalid_request", Description: param + " is invalid"}
+	}
+	// impersonation tokens are always detected, so minted token can not drop the real user
+	principal.Impersonator = tokenImpersonator(token)
+	return claims, principal, nil
+}
+
+// tokenScopes returns scopes of the token from space separated `scope` claim or `scp` array claim.
+func tokenScopes(claims jwt.MapClaims) []string {
+	if scope, ok := claimString(claims, "scope"); ok {
+		return strings.Fields(scope)
+	}
+	return claimStrings(claims, "scp")
+}
+
+func isExchangeReservedClaim(name string) bool {
+	switch name {
+	case "iss", "sub", "aud", "exp", "nbf", "iat", "jti", "scope", "act", ImpersonatorClaim:
+		return true
+	}
+	return false
+}
+
+// newTokenID returns random `jti` claim value.
+func newTokenID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tokenSigner signs tokens minted by token exchange and impersonation handlers.
+type tokenSigner struct {
+	method jwt.SigningMethod
+	key    interface{}
+	keyID  string
+}
+
+func newTokenSigner(method string, key interface{}, keyID string) (*tokenSigner, error) {
+	if key == nil {
+		return nil, errors.New("requires signing key")
+	}
+	if method == "" {
+		method = AlgorithmHS256
+	}
+	m := jwt.GetSigningMethod(method)
+	if m == nil || m == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("signing method %v is not supported", method)
+	}
+	if _, err := jwt.New(m).SignedString(key); err != nil {
+		return nil, fmt.Errorf("signing key can not be used with signing method %v: %w", method, err)
+	}
+	return &tokenSigner{method: m, key: key, keyID: keyID}, nil
+}
+
+func (s *tokenSigner) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.keyID != "" {
+		token.Header["kid"] = s.keyID
+	}
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("jwt failed to sign token: %w", err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,344 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTokenExchangeConfig() TokenExchangeConfig {
+	return TokenExchangeConfig{
+		SubjectToken:  Config{SigningKey: jwttest.Key("HS256").PublicKey},
+		SigningKey:    jwttest.Key("ES256").PrivateKey,
+		SigningMethod: "ES256",
+		KeyID:         "exchange",
+		Issuer:        "https://sts.example.com",
+	}
+}
+
+func doTokenExchange(t *testing.T, config TokenExchangeConfig, form url.Values, principal *Principal) *httptest.ResponseRecorder {
+	h, err := config.ToHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if principal != nil {
+		c.Set(PrincipalContextKey, principal)
+	}
+	if err := h(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func exchangeForm(subjectToken string, params ...string) url.Values {
+	form := url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {TokenTypeAccessToken},
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		form.Add(params[i], params[i+1])
+	}
+	return form
+}
+
+func TestTokenExchangeConfig_ToHandler(t *testing.T) {
+	subject := jwttest.NewToken("HS256").Claim("scope", "read write").Claim("tenant", "acme").ExpiresIn(time.Minute).
+		Audience(jwttest.DefaultAudience, "https://b.example.com").MustSign(t)
+	delegated := jwttest.NewToken("HS256").Claim("scope", "read").Claim("act", map[string]interface{}{"sub": "service-a"}).MustSign(t)
+	actor := jwttest.NewToken("HS256").Subject("service-b").Claim("client_id", "svc-b").MustSign(t)
+	impersonation := jwttest.NewToken("HS256").Subject("customer-42").Claim("scope", "read").
+		Claim(ImpersonatorClaim, map[string]interface{}{"sub": "admin-1"}).MustSign(t)
+
+	var testCases = []struct {
+		name            string
+		givenConfig     func(config *TokenExchangeConfig)
+		whenForm        url.Values
+		whenPrincipal   *Principal
+		expectScope     string
+		expectClaims    jwt.MapClaims
+		expectActors    []string
+		expectErrorBody string
+	}{
+		{
+			name: "ok, downscoped token with actor token",
+			givenConfig: func(config *TokenExchangeConfig) {
+				config.CopyClaims = []string{"tenant", "iss"}
+			},
+			whenForm: exchangeForm(subject,
+				"actor_token", actor, "actor_token_type", TokenTypeJWT,
+				"scope", "read", "audience", "https://b.example.com"),
+			expectScope: "read",
+			expectClaims: jwt.MapClaims{
+				"iss":    "https://sts.example.com",
+				"sub":    jwttest.DefaultSubject,
+				"aud":    []interface{}{"https://b.example.com"},
+				"scope":  "read",
+				"tenant": "acme",
+				"act": map[string]interface{}{
+					"sub":       "service-b",
+					"iss":       jwttest.DefaultIssuer,
+					"client_id": "svc-b",
+				},
+			},
+			expectActors: []string{"service-b"},
+		},
+		{
+			name:        "ok, audience defaults to subject token audience",
+			whenForm:    exchangeForm(subject, "scope", "read"),
+			expectScope: "read",
+			expectClaims: jwt.MapClaims{
+				"aud": []interface{}{jwttest.DefaultAudience, "https://b.example.com"},
+			},
+		},
+		{
+			name: "ok, allowed audience outside subject token audience",
+			givenConfig: func(config *TokenExchangeConfig) {
+				config.AllowedAudiences = []string{"https://c.example.com"}
+			},
+			whenForm:     exchangeForm(subject, "scope", "read", "resource", "https://c.example.com"),
+			expectScope:  "read",
+			expectClaims: jwt.MapClaims{"aud": []interface{}{"https://c.example.com"}},
+		},
+		{
+			name:        "ok, actor is nested with prior actors",
+			whenForm:    exchangeForm(delegated, "actor_token", actor, "actor_token_type", TokenTypeJWT),
+			expectScope: "read",
+			expectActors: []string{
+				"service-b",
+				"service-a",
+			},
+		},
+		{
+			name:          "ok, actor is authenticated principal",
+			whenForm:      exchangeForm(delegated),
+			whenPrincipal: &Principal{Scheme: AuthSchemeBasic, Subject: "service-c"},
+			expectScope:   "read",
+			expectActors:  []string{"service-c", "service-a"},
+		},
+		{
+			name: "ok, impersonator claim is kept",
+			givenConfig: func(config *TokenExchangeConfig) {
+				config.CopyClaims = []string{ImpersonatorClaim}
+			},
+			whenForm:    exchangeForm(impersonation, "actor_token", actor, "actor_token_type", TokenTypeJWT),
+			expectScope: "read",
+			expectClaims: jwt.MapClaims{
+				"sub":             "customer-42",
+				ImpersonatorClaim: map[string]interface{}{"sub": "admin-1"},
+			},
+			expectActors: []string{"service-b"},
+		},
+		{
+			name: "ok, impersonator claim is kept for struct claims",
+			givenConfig: func(config *TokenExchangeConfig) {
+				config.SubjectToken.NewClaimsFunc = func(c *echo.Context) jwt.Claims { return &jwt.RegisteredClaims{} }
+			},
+			whenForm: exchangeForm(impersonation),
+			expectClaims: jwt.MapClaims{
+				"sub":             "customer-42",
+				ImpersonatorClaim: map[string]interface{}{"sub": "admin-1"},
+			},
+		},
+		{
+			name:         "ok, non-object impersonator claim is not kept",
+			givenConfig:  func(config *TokenExchangeConfig) { config.CopyClaims = []string{ImpersonatorClaim} },
+			whenForm:     exchangeForm(jwttest.NewToken("HS256").Claim(ImpersonatorClaim, "ops-bot").MustSign(t)),
+			expectClaims: jwt.MapClaims{ImpersonatorClaim: nil},
+		},
+		{
+			name:         "ok, without actor act claim is kept",
+			whenForm:     exchangeForm(delegated),
+			expectScope:  "read",
+			expectActors: []string{"service-a"},
+		},
+		{
+			name:            "nok, unsupported grant type",
+			whenForm:        url.Values{"grant_type": {"client_credentials"}},
+			expectErrorBody: `{"error":"unsupported_grant_type"}`,
+		},
+		{
+			name:            "nok, missing subject token",
+			whenForm:        url.Values{"grant_type": {GrantTypeTokenExchange}},
+			expectErrorBody: `{"error":"invalid_request","error_description":"subject_token is required"}`,
+		},
+		{
+			name:            "nok, unsupported subject token type",
+			whenForm:        url.Values{"grant_type": {GrantTypeTokenExchange}, "subject_token": {subject}, "subject_token_type": {"urn:x"}},
+			expectErrorBody: `{"error":"invalid_request","error_description":"unsupported subject_token_type"}`,
+		},
+		{
+			name:            "nok, invalid subject token",
+			whenForm:        exchangeForm(jwttest.NewToken("HS256").Expired().MustSign(t)),
+			expectErrorBody: `{"error":"invalid_request","error_description":"subject_token is invalid"}`,
+		},
+		{
+			name:            "nok, invalid actor token",
+			whenForm:        exchangeForm(subject, "actor_token", "a.b.c", "actor_token_type", TokenTypeJWT),
+			expectErrorBody: `{"error":"invalid_request","error_description":"actor_token is invalid"}`,
+		},
+		{
+			name:            "nok, scope exceeds subject token scope",
+			whenForm:        exchangeForm(subject, "scope", "read admin"),
+			expectErrorBody: `{"error":"invalid_scope","error_description":"scope exceeds subject token scope"}`,
+		},
+		{
+			name:            "nok, audience outside subject token audience",
+			whenForm:        exchangeForm(subject, "audience", "https://c.example.com"),
+			expectErrorBody: `{"error":"invalid_target","error_description":"audience is not allowed"}`,
+		},
+		{
+			name: "nok, audience not allowed",
+			givenConfig: func(config *TokenExchangeConfig) {
+				config.AllowedAudiences = []string{"https://b.example.com"}
+			},
+			whenForm:        exchangeForm(subject, "resource", "https://c.example.com"),
+			expectErrorBody: `{"error":"invalid_target","error_description":"audience is not allowed"}`,
+		},
+		{
+			name: "nok, delegation depth exceeded",
+			givenConfig: func(config *TokenExchangeConfig) {
+				config.MaxDelegationDepth = 1
+			},
+			whenForm:        exchangeForm(delegated, "actor_token", actor, "actor_token_type", TokenTypeJWT),
+			expectErrorBody: `{"error":"invalid_request","error_description":"delegation depth exceeds allowed depth"}`,
+		},
+		{
+			name: "nok, policy rejects",
+			givenConfig: func(config *TokenExchangeConfig) {
+				config.Policy = func(c *echo.Context, exchange *TokenExchange) error {
+					if exchange.Actors[0].ClientID != "svc-a" {
+						return errors.New("actor is not allowed to delegate")
+					}
+					return nil
+				}
+			},
+			whenForm:        exchangeForm(subject, "actor_token", actor, "actor_token_type", TokenTypeJWT),
+			expectErrorBody: `{"error":"invalid_request","error_description":"actor is not allowed to delegate"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testTokenExchangeConfig()
+			if tc.givenConfig != nil {
+				tc.givenConfig(&config)
+			}
+
+			rec := doTokenExchange(t, config, tc.whenForm, tc.whenPrincipal)
+
+			assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+			if tc.expectErrorBody != "" {
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+				assert.JSONEq(t, tc.expectErrorBody, rec.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var res TokenExchangeResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, TokenTypeAccessToken, res.IssuedTokenType)
+			assert.Equal(t, "Bearer", res.TokenType)
+			assert.Equal(t, tc.expectScope, res.Scope)
+			assert.True(t, res.ExpiresIn > 0 && res.ExpiresIn <= 300)
+
+			token, err := jwt.Parse(res.AccessToken, func(token *jwt.Token) (interface{}, error) {
+				return jwttest.Key("ES256").PublicKey, nil
+			}, jwt.WithValidMethods([]string{"ES256"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "exchange", token.Header["kid"])
+			claims := token.Claims.(jwt.MapClaims)
+			for k, v := range tc.expectClaims {
+				assert.Equal(t, v, claims[k], k)
+			}
+			assert.NotEmpty(t, claims["jti"])
+
+			chain, err := ActorChain(token.Claims)
+			assert.NoError(t, err)
+			var actors []string
+			for _, a := range chain {
+				actors = append(actors, a.Subject)
+			}
+			assert.Equal(t, tc.expectActors, actors)
+		})
+	}
+}
+
+func TestTokenExchangeConfig_ToHandler_tokenLifetime(t *testing.T) {
+	subject := jwttest.NewToken("HS256").ExpiresIn(30 * time.Second).MustSign(t)
+
+	rec := doTokenExchange(t, testTokenExchangeConfig(), exchangeForm(subject), nil)
+
+	var res TokenExchangeResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.True(t, res.ExpiresIn > 0 && res.ExpiresIn <= 30, res.ExpiresIn)
+}
+
+func TestTokenExchangeConfig_ToHandler_error(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		whenConfig  TokenExchangeConfig
+		expectError string
+	}{
+		{
+			name:        "nok, missing signing key",
+			whenConfig:  TokenExchangeConfig{SubjectToken: Config{SigningKey: []byte("secret")}},
+			expectError: "jwt token exchange requires signing key",
+		},
+		{
+			name:        "nok, none signing method",
+			whenConfig:  TokenExchangeConfig{SubjectToken: Config{SigningKey: []byte("secret")}, SigningKey: []byte("x"), SigningMethod: "none"},
+			expectError: "jwt token exchange signing method none is not supported",
+		},
+		{
+			name: "nok, signing key does not match signing method",
+			whenConfig: TokenExchangeConfig{
+				SubjectToken:  Config{SigningKey: []byte("secret")},
+				SigningKey:    []byte("secret"),
+				SigningMethod: "RS256",
+			},
+			expectError: "jwt token exchange signing key can not be used with signing method RS256: key is of invalid type: RSA sign expects *rsa.PrivateKey",
+		},
+		{
+			name:        "nok, invalid subject token config",
+			whenConfig:  TokenExchangeConfig{SigningKey: []byte("secret")},
+			expectError: "jwt token exchange subject token config: jwt middleware requires signing key",
+		},
+		{
+			name: "nok, invalid actor token config",
+			whenConfig: TokenExchangeConfig{
+				SubjectToken: Config{SigningKey: []byte("secret")},
+				ActorToken:   &Config{},
+				SigningKey:   []byte("secret"),
+			},
+			expectError: "jwt token exchange actor token config: jwt middleware requires signing key",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.whenConfig.ToHandler()
+			assert.EqualError(t, err, tc.expectError)
+		})
+	}
+
+	assert.Panics(t, func() { TokenExchangeHandler(TokenExchangeConfig{}) })
+}
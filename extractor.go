@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+const (
+	// ExtractorSourceWebSocketProtocol means value was extracted from `Sec-WebSocket-Protocol` request header
+	ExtractorSourceWebSocketProtocol middleware.ExtractorSource = "websocket"
+	// ExtractorSourceChunkedCookie means value was joined from multiple cookies
+	ExtractorSourceChunkedCookie middleware.ExtractorSource = "chunkedcookie"
+	// ExtractorSourceJSONBody means value was extracted from JSON request body
+	ExtractorSourceJSONBody middleware.ExtractorSource = "json"
+)
+
+// HeaderSecWebSocketProtocol is WebSocket subprotocol negotiation header
+const HeaderSecWebSocketProtocol = "Sec-WebSocket-Protocol"
+
+var errWebSocketProtocolValueMissing = errors.New("missing value in websocket protocol header")
+var errChunkedCookieValueMissing = errors.New("missing value in chunked cookies")
+var errJSONBodyValueMissing = errors.New("missing value in json body")
+var errJSONBodyTooLarge = errors.New("json body is too large to extract value")
+
+// DefaultJSONBodyLimit is default maximum size of request body read by ValuesFromJSONBody.
+const DefaultJSONBodyLimit = 64 * 1024
+
+// createExtractors creates ValuesExtractors from given lookups. Lookups specific to this library are handled here,
+// all other lookups are created with middleware.CreateExtractors.
+//
+// Additional lookup sources:
+//   - "websocket:<prefix>"
+//   - "chunkedcookie:<name>"
+//   - "json:<path>"
+func createExtractors(lookups string) ([]middleware.ValuesExtractor, error) {
+	if lookups == "" {
+		return nil, nil
+	}
+	extractors := make([]middleware.ValuesExtractor, 0)
+	for _, source := range strings.Split(lookups, ",") {
+		parts := strings.Split(source, ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("extractor source for lookup could not be split into needed parts: %v", source)
+		}
+		switch parts[0] {
+		case string(ExtractorSourceWebSocketProtocol):
+			prefix := strings.Join(parts[1:], ":")
+			if prefix == "" {
+				return nil, fmt.Errorf("extractor source for lookup requires websocket subprotocol prefix: %v", source)
+			}
+			extractors = append(extractors, ValuesFromWebSocketProtocol(prefix))
+		case string(ExtractorSourceChunkedCookie):
+			extractors = append(extractors, ValuesFromChunkedCookie(parts[1]))
+		case string(ExtractorSourceJSONBody):
+			extractors = append(extractors, ValuesFromJSONBody(strings.Join(parts[1:], ":"), DefaultJSONBodyLimit))
+		default:
+			e, err := middleware.CreateExtractors(source, 1)
+			if err != nil {
+				return nil, err
+			}
+			extractors = append(extractors, e...)
+		}
+	}
+	return extractors, nil
+}
+
+// ValuesFromWebSocketProtocol returns a function that extracts token from `Sec-WebSocket-Protocol` header of WebSocket
+// upgrade request. Browsers can not set `Authorization` header for WebSocket handshake, instead client offers token as
+// one of the subprotocols with given prefix, for example:
+//
+//	new WebSocket(url, ["chat", "access_token." + token])
+//
+// with prefix `access_token.`. Note: tokens must not contain characters not allowed in subprotocol names, base64url
+// encoded JWTs are fine.
+//
+// When token is extracted with this extractor, the middleware selects the first offered subprotocol not containing
+// the token (`chat` in the example above), so the token is not echoed back. When the token subprotocol is the only one
+// offered, it is selected as browsers fail the handshake when none of the offered subprotocols is selected. Selected
+// subprotocol is set to `Sec-WebSocket-Protocol` header of c.Response(), but WebSocket upgraders hijack the connection
+// and write only headers passed to them, so handler must pass the selected subprotocol to the upgrader, for example
+// with gorilla/websocket:
+//
+//	header := http.Header{}
+//	header.Set(echojwt.HeaderSecWebSocketProtocol, echojwt.SelectedWebSocketProtocol(c))
+//	conn, err := upgrader.Upgrade(c.Response(), c.Request(), header)
+func ValuesFromWebSocketProtocol(prefix string) middleware.ValuesExtractor {
+	return func(c *echo.Context) ([]string, middleware.ExtractorSource, error) {
+		if !c.IsWebSocket() {
+			return nil, ExtractorSourceWebSocketProtocol, errWebSocketProtocolValueMissing
+		}
+		for _, protocol := range webSocketProtocols(c.Request()) {
+			if len(protocol) > len(prefix) && strings.HasPrefix(protocol, prefix) {
+				return []string{protocol[len(prefix):]}, ExtractorSourceWebSocketProtocol, nil
+			}
+		}
+		return nil, ExtractorSourceWebSocketProtocol, errWebSocketProtocolValueMissing
+	}
+}
+
+// webSocketProtocols returns subprotocols offered in `Sec-WebSocket-Protocol` request headers.
+func webSocketProtocols(r *http.Request) []string {
+	var result []string
+	for _, value := range r.Header.Values(HeaderSecWebSocketProtocol) {
+		for _, protocol := range strings.Split(value, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				result = append(result, protocol)
+			}
+		}
+	}
+	return result
+}
+
+// SelectedWebSocketProtocol returns subprotocol selected by the middleware for WebSocket upgrade request authenticated
+// with token from ValuesFromWebSocketProtocol extractor. Returns empty string when no subprotocol was selected.
+func SelectedWebSocketProtocol(c *echo.Context) string {
+	return c.Response().Header().Get(HeaderSecWebSocketProtocol)
+}
+
+// selectWebSocketProtocol sets `Sec-WebSocket-Protocol` response header to the first offered subprotocol that does not
+// carry the token or, when there is no such subprotocol, to the subprotocol carrying the token.
+func selectWebSocketProtocol(c *echo.Context, token string) {
+	protocols := webSocketProtocols(c.Request())
+	for _, protocol := range protocols {
+		if !strings.HasSuffix(protocol, token) {
+			c.Response().Header().Set(HeaderSecWebSocketProtocol, protocol)
+			return
+		}
+	}
+	if len(protocols) > 0 {
+		c.Response().Header().Set(HeaderSecWebSocketProtocol, protocols[0])
+	}
+}
+
+// ValuesFromJSONBody returns a function that extracts token from JSON request body field. Path is dot separated list
+// of object keys, for example `auth.token` extracts token from `{"auth":{"token":"<token>"}}`. Only requests with
+// `application/json` content type and body not larger than limit bytes are considered. Request body is restored after
+// reading so handlers can still bind it.
+//
+// limit <= 0 means DefaultJSONBodyLimit.
+func ValuesFromJSONBody(path string, limit int64) middleware.ValuesExtractor {
+	if limit <= 0 {
+		limit = DefaultJSONBodyLimit
+	}
+	keys := strings.Split(path, ".")
+	return func(c *echo.Context) ([]string, middleware.ExtractorSource, error) {
+		req := c.Request()
+		if req.Body == nil || req.Body == http.NoBody {
+			return nil, ExtractorSourceJSONBody, errJSONBodyValueMissing
+		}
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+		if mediaType != echo.MIMEApplicationJSON {
+			return nil, ExtractorSourceJSONBody, errJSONBodyValueMissing
+		}
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+		if int64(len(body)) > limit {
+			req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+			return nil, ExtractorSourceJSONBody, errJSONBodyTooLarge
+		}
+		req.Body = readCloser{Reader: bytes.NewReader(body), Closer: req.Body}
+		if err != nil {
+			return nil, ExtractorSourceJSONBody, errJSONBodyValueMissing
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return nil, ExtractorSourceJSONBody, errJSONBodyValueMissing
+		}
+		for _, key := range keys {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, ExtractorSourceJSONBody, errJSONBodyValueMissing
+			}
+			value = object[key]
+		}
+		token, ok := value.(string)
+		if !ok || token == "" {
+			return nil, ExtractorSourceJSONBody, errJSONBodyValueMissing
+		}
+		return []string{token}, ExtractorSourceJSONBody, nil
+	}
+}
+
+// readCloser replaces request body reader keeping the original body Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
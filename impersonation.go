@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+// ImpersonatorClaim is name of the claim identifying the real user of impersonation token. Claim value is an object
+// with `sub` member, for example `{"sub": "admin-1"}`.
+const ImpersonatorClaim = "impersonator"
+
+// AuditEvent describes authenticated request passed to audit handlers.
+type AuditEvent struct {
+	// Principal is principal of the request. Principal.Subject is the effective identity and Principal.RealSubject the
+	// real one.
+	Principal *Principal
+
+	// Impersonated is true when the request is made with impersonation token.
+	Impersonated bool
+}
+
+// ImpersonationConfig defines the config for impersonation handler. Impersonation handler mints short-lived token for
+// the target subject with `impersonator` claim recording the real user, so support staff can act as a customer without
+// knowing customer credentials. JWT middleware with Config.DetectImpersonation or Config.AuditHandler set exposes the
+// real identity as Principal.Impersonator and flags requests made with such tokens in Config.AuditHandler.
+//
+// Impersonation handler must be executed after JWT middleware validating the admin token. Admin token is authorized
+// with Policy and Validator. Impersonation tokens can not be used to impersonate again.
+type ImpersonationConfig struct {
+	// ContextKey is key where JWT middleware stored the admin token in context.
+	// Optional. Default value "user".
+	ContextKey string
+
+	// Policy is authorization policy expression admin token must satisfy, for example `"support" in claim.roles`.
+	// See Policy for syntax. Expression is compiled when handler is created.
+	// Optional. Either Policy or Validator is required.
+	Policy string
+
+	// Validator is called with principal of the admin token and target subject and rejects the impersonation by
+	// returning an error, for example when target is another admin.
+	// Optional. Either Policy or Validator is required.
+	Validator func(c *echo.Context, impersonator *Principal, target string) error
+
+	// SigningKey is private key (or secret for HMAC) minted tokens are signed with.
+	// Required.
+	SigningKey interface{}
+
+	// SigningMethod is algorithm minted tokens are signed with.
+	// Optional. Default value HS256.
+	SigningMethod string
+
+	// KeyID is `kid` header of minted tokens.
+	// Optional.
+	KeyID string
+
+	// Issuer is `iss` claim of minted tokens.
+	// Optional.
+	Issuer string
+
+	// Audience is `aud` claim of minted tokens.
+	// Optional.
+	Audience []string
+
+	// TTL is lifetime of minted tokens.
+	// Optional. Default value 15 minutes.
+	TTL time.Duration
+
+	// AuditHandler defines a function which is executed when impersonation token is minted. Event Principal is the
+	// impersonated principal.
+	// Optional.
+	AuditHandler func(c *echo.Context, event AuditEvent)
+}
+
+// ImpersonationResponse is response of impersonation handler.
+type ImpersonationResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// ErrImpersonationNotAllowed denotes an error raised when admin token is not allowed to impersonate the target
+var ErrImpersonationNotAllowed = echo.NewHTTPError(http.StatusForbidden, "impersonation not allowed")
+
+// ImpersonationHandler returns impersonation handler or panics if configuration is invalid.
+//
+// Handler reads target subject from `sub` form or query parameter and responds with ImpersonationResponse. Without
+// admin token in context handler returns "401 - Unauthorized", for admin token not allowed to impersonate "403 -
+// Forbidden" error.
+func ImpersonationHandler(config ImpersonationConfig) echo.HandlerFunc {
+	h, err := config.ToHandler()
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// ToHandler converts ImpersonationConfig to handler or returns an error for invalid configuration
+func (config ImpersonationConfig) ToHandler() (echo.HandlerFunc, error) {
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if config.Policy == "" && config.Validator == nil {
+		return nil, errors.New("jwt impersonation requires policy or validator")
+	}
+	var policy *Policy
+	if config.Policy != "" {
+		var err error
+		if policy, err = CompilePolicy(config.Policy); err != nil {
+			return nil, err
+		}
+	}
+	signer, err := newTokenSigner(config.SigningMethod, config.SigningKey, config.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("jwt impersonation %w", err)
+	}
+	if config.TTL <= 0 {
+		config.TTL = 15 * time.Minute
+	}
+
+	return func(c *echo.Context) error {
+		token, err := tokenFromContext(c, config.ContextKey)
+		if err != nil {
+			return ErrJWTMissing.Wrap(err)
+		}
+		claims, err := claimsToMap(token.Claims)
+		if err != nil {
+			return ErrJWTInvalid.Wrap(err)
+		}
+		impersonator, _ := claimString(claims, "sub")
+		if impersonator == "" {
+			return ErrImpersonationNotAllowed.Wrap(errors.New("admin token is missing sub claim"))
+		}
+		if _, ok := claims[ImpersonatorClaim]; ok || tokenImpersonator(token) != "" {
+			return ErrImpersonationNotAllowed.Wrap(errors.New("impersonation token can not impersonate"))
+		}
+		target := c.FormValue("sub")
+		if target == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "missing sub parameter")
+		}
+		if target == impersonator {
+			return ErrImpersonationNotAllowed.Wrap(errors.New("can not impersonate self"))
+		}
+		if policy != nil && !policy.Allow(c, claims) {
+			return ErrImpersonationNotAllowed.Wrap(fmt.Errorf("policy denied: %v", policy))
+		}
+		if config.Validator != nil {
+			admin := PrincipalFromContext(c)
+			if admin == nil {
+				admin = newTokenPrincipal(token)
+			}
+			if err := config.Validator(c, admin, target); err != nil {
+				return ErrImpersonationNotAllowed.Wrap(err)
+			}
+		}
+
+		now := time.Now()
+		expiresAt := now.Add(config.TTL)
+		minted := jwt.MapClaims{
+			"sub":             target,
+			ImpersonatorClaim: map[string]interface{}{"sub": impersonator},
+			"iat":             now.Unix(),
+			"exp":             expiresAt.Unix(),
+			"jti":             newTokenID(),
+		}
+		if config.Issuer != "" {
+			minted["iss"] = config.Issuer
+		}
+		if len(config.Audience) > 0 {
+			minted["aud"] = config.Audience
+		}
+		signed, err := signer.sign(minted)
+		if err != nil {
+			return err
+		}
+		if config.AuditHandler != nil {
+			principal := &Principal{Scheme: AuthSchemeJWT, Subject: target, Impersonator: impersonator}
+			config.AuditHandler(c, AuditEvent{Principal: principal, Impersonated: true})
+		}
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return c.JSON(http.StatusOK, ImpersonationResponse{
+			AccessToken: signed,
+			TokenType:   "Bearer",
+			ExpiresIn:   expiresAt.Unix() - now.Unix(),
+		})
+	}, nil
+}
+
+// tokenImpersonator returns subject of `impersonator` claim of the token or empty string for token without the claim.
+// Claim values that are not an object with `sub` member are ignored, so tokens using `impersonator` claim for other
+// purposes are not rejected.
+//
+// Custom claims types do not declare `impersonator` claim, so for them the claim is decoded from the verified payload
+// segment of the raw token.
+func tokenImpersonator(token interface{}) string {
+	t, ok := token.(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	switch cl := t.Claims.(type) {
+	case jwt.MapClaims:
+		return impersonatorSubject(cl[ImpersonatorClaim])
+	case *jwt.MapClaims:
+		return impersonatorSubject((*cl)[ImpersonatorClaim])
+	}
+	_, rest, ok := strings.Cut(t.Raw, ".")
+	if !ok {
+		return ""
+	}
+	segment, _, ok := strings.Cut(rest, ".")
+	if !ok {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Impersonator interface{} `json:"impersonator"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return impersonatorSubject(claims.Impersonator)
+}
+
+// impersonatorSubject returns `sub` member of `impersonator` claim value.
+func impersonatorSubject(value interface{}) string {
+	m, _ := value.(map[string]interface{})
+	sub, _ := m["sub"].(string)
+	return sub
+}
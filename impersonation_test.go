@@ -0,0 +1,367 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func testImpersonationConfig() ImpersonationConfig {
+	return ImpersonationConfig{
+		Policy:     `"support" in claim.roles`,
+		SigningKey: jwttest.Key("HS256").PrivateKey,
+		Issuer:     "https://support.example.com",
+	}
+}
+
+func doImpersonation(config ImpersonationConfig, adminClaims jwt.MapClaims, target string) (*httptest.ResponseRecorder, error) {
+	h, err := config.ToHandler()
+	if err != nil {
+		return nil, err
+	}
+	req := httptest.NewRequest(http.MethodPost, "/impersonate", strings.NewReader(url.Values{"sub": {target}}.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if adminClaims != nil {
+		c.Set("user", &jwt.Token{Claims: adminClaims})
+	}
+	return rec, h(c)
+}
+
+func TestImpersonationConfig_ToHandler(t *testing.T) {
+	admin := jwt.MapClaims{"sub": "admin-1", "roles": []interface{}{"support"}}
+
+	var testCases = []struct {
+		name        string
+		givenConfig func(config *ImpersonationConfig)
+		whenClaims  jwt.MapClaims
+		whenTarget  string
+		expectError string
+	}{
+		{
+			name:       "ok",
+			whenClaims: admin,
+			whenTarget: "customer-42",
+		},
+		{
+			name:        "nok, admin token missing",
+			whenTarget:  "customer-42",
+			expectError: "code=401, message=missing or malformed jwt, err=jwt token missing from context",
+		},
+		{
+			name:        "nok, policy denies",
+			whenClaims:  jwt.MapClaims{"sub": "user-1", "roles": []interface{}{"user"}},
+			whenTarget:  "customer-42",
+			expectError: `code=403, message=impersonation not allowed, err=policy denied: "support" in claim.roles`,
+		},
+		{
+			name:        "nok, missing target",
+			whenClaims:  admin,
+			expectError: "code=400, message=missing sub parameter",
+		},
+		{
+			name:        "nok, self",
+			whenClaims:  admin,
+			whenTarget:  "admin-1",
+			expectError: "code=403, message=impersonation not allowed, err=can not impersonate self",
+		},
+		{
+			name: "nok, impersonation token",
+			whenClaims: jwt.MapClaims{
+				"sub":             "admin-2",
+				"roles":           []interface{}{"support"},
+				ImpersonatorClaim: map[string]interface{}{"sub": "admin-1"},
+			},
+			whenTarget:  "customer-42",
+			expectError: "code=403, message=impersonation not allowed, err=impersonation token can not impersonate",
+		},
+		{
+			name: "nok, validator rejects",
+			givenConfig: func(config *ImpersonationConfig) {
+				config.Validator = func(c *echo.Context, impersonator *Principal, target string) error {
+					if strings.HasPrefix(target, "admin-") {
+						return errors.New("admins can not be impersonated")
+					}
+					return nil
+				}
+			},
+			whenClaims:  admin,
+			whenTarget:  "admin-2",
+			expectError: "code=403, message=impersonation not allowed, err=admins can not be impersonated",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testImpersonationConfig()
+			if tc.givenConfig != nil {
+				tc.givenConfig(&config)
+			}
+			var events []AuditEvent
+			config.AuditHandler = func(c *echo.Context, event AuditEvent) {
+				events = append(events, event)
+			}
+
+			rec, err := doImpersonation(config, tc.whenClaims, tc.whenTarget)
+
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				assert.Empty(t, events)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+			var res ImpersonationResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, "Bearer", res.TokenType)
+			assert.Equal(t, int64(900), res.ExpiresIn)
+
+			token, err := jwt.Parse(res.AccessToken, func(token *jwt.Token) (interface{}, error) {
+				return jwttest.Key("HS256").PublicKey, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := token.Claims.(jwt.MapClaims)
+			assert.Equal(t, tc.whenTarget, claims["sub"])
+			assert.Equal(t, "https://support.example.com", claims["iss"])
+			assert.Equal(t, map[string]interface{}{"sub": "admin-1"}, claims[ImpersonatorClaim])
+			assert.Equal(t, []AuditEvent{{
+				Principal:    &Principal{Scheme: AuthSchemeJWT, Subject: tc.whenTarget, Impersonator: "admin-1"},
+				Impersonated: true,
+			}}, events)
+		})
+	}
+}
+
+func TestConfig_AuditHandler(t *testing.T) {
+	registeredClaims := func(c *echo.Context) jwt.Claims { return &jwt.RegisteredClaims{} }
+
+	var testCases = []struct {
+		name            string
+		givenNewClaims  func(c *echo.Context) jwt.Claims
+		whenToken       *jwttest.TokenBuilder
+		expectPrincipal *Principal
+		expectEvent     bool
+		expectError     string
+	}{
+		{
+			name:            "ok, regular token",
+			whenToken:       jwttest.NewToken("HS256"),
+			expectPrincipal: &Principal{Scheme: AuthSchemeJWT, Subject: jwttest.DefaultSubject},
+			expectEvent:     true,
+		},
+		{
+			name:      "ok, impersonation token",
+			whenToken: jwttest.NewToken("HS256").Subject("customer-42").Claim(ImpersonatorClaim, map[string]interface{}{"sub": "admin-1"}),
+			expectPrincipal: &Principal{
+				Scheme:       AuthSchemeJWT,
+				Subject:      "customer-42",
+				Impersonator: "admin-1",
+			},
+			expectEvent: true,
+		},
+		{
+			name:           "ok, impersonation token with struct claims",
+			givenNewClaims: registeredClaims,
+			whenToken:      jwttest.NewToken("HS256").Subject("customer-42").Claim(ImpersonatorClaim, map[string]interface{}{"sub": "admin-1"}),
+			expectPrincipal: &Principal{
+				Scheme:       AuthSchemeJWT,
+				Subject:      "customer-42",
+				Impersonator: "admin-1",
+			},
+			expectEvent: true,
+		},
+		{
+			name:            "ok, non-object impersonator claim with struct claims is ignored",
+			givenNewClaims:  registeredClaims,
+			whenToken:       jwttest.NewToken("HS256").Claim(ImpersonatorClaim, "ops-bot"),
+			expectPrincipal: &Principal{Scheme: AuthSchemeJWT, Subject: jwttest.DefaultSubject},
+			expectEvent:     true,
+		},
+		{
+			name:            "ok, non-object impersonator claim is ignored",
+			whenToken:       jwttest.NewToken("HS256").Claim(ImpersonatorClaim, "ops-bot"),
+			expectPrincipal: &Principal{Scheme: AuthSchemeJWT, Subject: jwttest.DefaultSubject},
+			expectEvent:     true,
+		},
+		{
+			name:        "nok, invalid token",
+			whenToken:   jwttest.NewToken("HS256").Expired(),
+			expectError: "code=401, message=invalid or expired jwt, err=token has invalid claims: token is expired",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []AuditEvent
+			mw, err := Config{
+				SigningKey:    jwttest.Key("HS256").PublicKey,
+				NewClaimsFunc: tc.givenNewClaims,
+				AuditHandler: func(c *echo.Context, event AuditEvent) {
+					events = append(events, event)
+				},
+			}.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.whenToken.MustSign(t))
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			var principal *Principal
+			err = mw(func(c *echo.Context) error {
+				principal = PrincipalFromContext(c)
+				return nil
+			})(c)
+
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				assert.Empty(t, events)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectPrincipal, principal)
+			assert.Equal(t, []AuditEvent{{Principal: principal, Impersonated: principal.IsImpersonated()}}, events)
+		})
+	}
+}
+
+func TestConfig_DetectImpersonation(t *testing.T) {
+	token := jwttest.NewToken("HS256").Subject("customer-42").Claim(ImpersonatorClaim, map[string]interface{}{"sub": "admin-1"})
+
+	var testCases = []struct {
+		name               string
+		givenConfig        Config
+		expectImpersonator string
+	}{
+		{
+			name:        "ok, detection is disabled by default",
+			givenConfig: Config{},
+		},
+		{
+			name:               "ok, map claims",
+			givenConfig:        Config{DetectImpersonation: true},
+			expectImpersonator: "admin-1",
+		},
+		{
+			name: "ok, struct claims",
+			givenConfig: Config{
+				DetectImpersonation: true,
+				NewClaimsFunc:       func(c *echo.Context) jwt.Claims { return &jwt.RegisteredClaims{} },
+			},
+			expectImpersonator: "admin-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.givenConfig
+			config.SigningKey = jwttest.Key("HS256").PublicKey
+			mw, err := config.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token.MustSign(t))
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			var principal *Principal
+			err = mw(func(c *echo.Context) error {
+				principal = PrincipalFromContext(c)
+				return nil
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "customer-42", principal.Subject)
+			assert.Equal(t, tc.expectImpersonator, principal.Impersonator)
+		})
+	}
+}
+
+func TestImpersonationConfig_ToHandler_structClaimsImpersonationToken(t *testing.T) {
+	raw := jwttest.NewToken("HS256").Subject("admin-2").Claim(ImpersonatorClaim, map[string]interface{}{"sub": "admin-1"}).MustSign(t)
+	token, err := jwt.ParseWithClaims(raw, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return jwttest.Key("HS256").PublicKey, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testImpersonationConfig()
+	config.Policy = ""
+	config.Validator = func(c *echo.Context, impersonator *Principal, target string) error { return nil }
+	h, err := config.ToHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/impersonate", strings.NewReader(url.Values{"sub": {"customer-42"}}.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set("user", token)
+
+	err = h(c)
+
+	assert.EqualError(t, err, "code=403, message=impersonation not allowed, err=impersonation token can not impersonate")
+}
+
+func TestConfig_AuditHandler_authChain(t *testing.T) {
+	var events []AuditEvent
+	authenticator, err := Config{
+		SigningKey: jwttest.Key("HS256").PublicKey,
+		AuditHandler: func(c *echo.Context, event AuditEvent) {
+			events = append(events, event)
+		},
+	}.ToAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwttest.NewToken("HS256").Subject("customer-42").Claim(ImpersonatorClaim, map[string]interface{}{"sub": "admin-1"})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token.MustSign(t))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	err = AuthChain(authenticator)(func(c *echo.Context) error { return nil })(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []AuditEvent{{
+		Principal:    &Principal{Scheme: AuthSchemeJWT, Subject: "customer-42", Impersonator: "admin-1"},
+		Impersonated: true,
+	}}, events)
+}
+
+func TestPrincipal_RealSubject(t *testing.T) {
+	p := &Principal{Subject: "customer-42"}
+	assert.Equal(t, "customer-42", p.RealSubject())
+	assert.False(t, p.IsImpersonated())
+
+	p.Impersonator = "admin-1"
+	assert.Equal(t, "admin-1", p.RealSubject())
+	assert.True(t, p.IsImpersonated())
+}
+
+func TestImpersonationConfig_ToHandler_error(t *testing.T) {
+	_, err := ImpersonationConfig{SigningKey: []byte("secret")}.ToHandler()
+	assert.EqualError(t, err, "jwt impersonation requires policy or validator")
+
+	_, err = ImpersonationConfig{Policy: "claim..a", SigningKey: []byte("secret")}.ToHandler()
+	assert.EqualError(t, err, `jwt policy "claim..a": invalid claim path ".a": empty claim name at position 0`)
+
+	_, err = ImpersonationConfig{Policy: "claim.admin"}.ToHandler()
+	assert.EqualError(t, err, "jwt impersonation requires signing key")
+
+	assert.Panics(t, func() { ImpersonationHandler(ImpersonationConfig{}) })
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+// IssuerProfile defines token validation rules for tokens issued by a single issuer (identity provider).
+type IssuerProfile struct {
+	// Issuer is the `iss` claim value of tokens validated by this profile.
+	// Required.
+	Issuer string
+
+	// Signing key to validate token.
+	// The order of precedence is a user-defined KeyFunc, SigningKeys and SigningKey.
+	// Required if neither user-defined KeyFunc nor SigningKeys is provided.
+	SigningKey interface{}
+
+	// Map of signing keys to validate token with kid field usage.
+	// The order of precedence is a user-defined KeyFunc, SigningKeys and SigningKey.
+	// Required if neither user-defined KeyFunc nor SigningKey is provided.
+	SigningKeys map[string]interface{}
+
+	// KeyFunc defines a user-defined function that supplies the public key for a token validation. Useful when issuer
+	// publishes its keys as JWKS.
+	// The order of precedence is a user-defined KeyFunc, SigningKeys and SigningKey.
+	// Required if neither SigningKeys nor SigningKey is provided.
+	KeyFunc jwt.Keyfunc
+
+	// SigningMethods is list of allowed token signing algorithms.
+	// Optional. Default value [HS256] when KeyFunc is not set, when KeyFunc is set algorithm is not checked by default.
+	SigningMethods []string
+
+	// Audience is list of accepted `aud` claim values. Token must contain at least one of them.
+	// Optional. When empty `aud` claim is not checked.
+	Audience []string
+
+	// NewClaimsFunc returns new claims instance token claims are unmarshalled into.
+	// Optional. Defaults to function returning jwt.MapClaims
+	NewClaimsFunc func(c *echo.Context) jwt.Claims
+}
+
+// issuerParsers selects validation profile by token `iss` claim.
+type issuerParsers map[string]*issuerParser
+
+type issuerParser struct {
+	profile IssuerProfile
+	parser  *jwt.Parser
+}
+
+func newIssuerParsers(profiles []IssuerProfile) (issuerParsers, error) {
+	result := make(issuerParsers, len(profiles))
+	for _, profile := range profiles {
+		if _, exists := result[profile.Issuer]; exists {
+			return nil, fmt.Errorf("jwt middleware has duplicate issuer profile: %v", profile.Issuer)
+		}
+		p, err := newIssuerParser(profile)
+		if err != nil {
+			return nil, err
+		}
+		result[profile.Issuer] = p
+	}
+	return result, nil
+}
+
+func newIssuerParser(profile IssuerProfile) (*issuerParser, error) {
+	if profile.Issuer == "" {
+		return nil, errors.New("jwt middleware issuer profile requires issuer")
+	}
+	if profile.SigningKey == nil && len(profile.SigningKeys) == 0 && profile.KeyFunc == nil {
+		return nil, fmt.Errorf("jwt middleware issuer profile requires signing key: %v", profile.Issuer)
+	}
+	if len(profile.SigningMethods) == 0 && profile.KeyFunc == nil {
+		profile.SigningMethods = []string{AlgorithmHS256}
+	}
+	if profile.NewClaimsFunc == nil {
+		profile.NewClaimsFunc = func(c *echo.Context) jwt.Claims {
+			return jwt.MapClaims{}
+		}
+	}
+	if profile.KeyFunc == nil {
+		if err := profile.validateSigningKeys(); err != nil {
+			return nil, err
+		}
+		profile.KeyFunc = profile.defaultKeyFunc
+	}
+
+	opts := []jwt.ParserOption{jwt.WithIssuer(profile.Issuer)}
+	if len(profile.SigningMethods) > 0 {
+		opts = append(opts, jwt.WithValidMethods(profile.SigningMethods))
+	}
+	if len(profile.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(profile.Audience...))
+	}
+	return &issuerParser{profile: profile, parser: jwt.NewParser(opts...)}, nil
+}
+
+// validateSigningKeys checks that SigningKey and SigningKeys types match at least one of SigningMethods.
+func (profile IssuerProfile) validateSigningKeys() error {
+	if len(profile.SigningKeys) == 0 {
+		if err := validateSigningKeyAny(profile.SigningMethods, profile.SigningKey); err != nil {
+			return fmt.Errorf("%w, issuer=%v", err, profile.Issuer)
+		}
+		return nil
+	}
+	for kid, key := range profile.SigningKeys {
+		if err := validateSigningKeyAny(profile.SigningMethods, key); err != nil {
+			return fmt.Errorf("%w, issuer=%v, key id=%v", err, profile.Issuer, kid)
+		}
+	}
+	return nil
+}
+
+// defaultKeyFunc selects key from profile keys.
+//
+// error returns TokenError.
+func (profile IssuerProfile) defaultKeyFunc(token *jwt.Token) (interface{}, error) {
+	if !slices.Contains(profile.SigningMethods, token.Method.Alg()) {
+		return nil, &TokenError{Token: token, Err: errUnexpectedSigningMethod(token)}
+	}
+	return lookupKey(token, profile.SigningKey, profile.SigningKeys)
+}
+
+// parseToken selects issuer profile by unverified `iss` claim and parses token with it.
+//
+// error returns TokenError.
+func (ip issuerParsers) parseToken(c *echo.Context, auth string) (interface{}, error) {
+	iss, token, err := unverifiedIssuer(auth)
+	if err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	p, ok := ip[iss]
+	if !ok {
+		return nil, &TokenError{Token: token, Err: fmt.Errorf("unexpected jwt issuer=%v", iss)}
+	}
+	token, err = p.parseToken(c, auth)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// parseToken parses and validates token with the profile.
+//
+// error returns TokenError.
+func (p *issuerParser) parseToken(c *echo.Context, auth string) (*jwt.Token, error) {
+	token, err := p.parser.ParseWithClaims(auth, p.profile.NewClaimsFunc(c), p.profile.KeyFunc)
+	if err != nil {
+		if token != nil && token.Method != nil && len(p.profile.SigningMethods) > 0 &&
+			!slices.Contains(p.profile.SigningMethods, token.Method.Alg()) {
+			err = ErrorKindAlgorithmNotAllowed.Wrap(err)
+		}
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	if !token.Valid {
+		return nil, &TokenError{Token: token, Err: errors.New("invalid token")}
+	}
+	if err := checkCriticalHeader(token); err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	return token, nil
+}
+
+// unverifiedIssuer returns `iss` claim from token without verifying the token signature. Returned value must only be
+// used to select how token is verified.
+func unverifiedIssuer(auth string) (string, *jwt.Token, error) {
+	claims := jwt.MapClaims{}
+	token, _, err := jwt.NewParser().ParseUnverified(auth, claims)
+	if err != nil {
+		return "", token, err
+	}
+	iss, err := claims.GetIssuer()
+	if err != nil {
+		return "", token, err
+	}
+	return iss, token, nil
+}
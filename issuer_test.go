@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Issuers(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuers := []IssuerProfile{
+		{
+			Issuer:     "https://first.example.com",
+			SigningKey: []byte("first_secret"),
+			Audience:   []string{"api"},
+		},
+		{
+			Issuer:         "https://second.example.com",
+			SigningKeys:    map[string]interface{}{"kid1": &rsaKey.PublicKey},
+			SigningMethods: []string{"RS256"},
+			NewClaimsFunc: func(c *echo.Context) jwt.Claims {
+				return &jwtCustomClaims{}
+			},
+		},
+	}
+
+	var testCases = []struct {
+		name        string
+		whenToken   string
+		expectError string
+		expectName  string
+	}{
+		{
+			name: "ok, first issuer",
+			whenToken: createToken(t, jwt.SigningMethodHS256, []byte("first_secret"),
+				jwt.MapClaims{"iss": "https://first.example.com", "aud": "api", "name": "John Doe"}, nil),
+			expectName: "John Doe",
+		},
+		{
+			name: "ok, second issuer with custom claims",
+			whenToken: createToken(t, jwt.SigningMethodRS256, rsaKey,
+				jwt.MapClaims{"iss": "https://second.example.com", "name": "Jane Doe"}, map[string]interface{}{"kid": "kid1"}),
+			expectName: "Jane Doe",
+		},
+		{
+			name: "nok, unknown issuer",
+			whenToken: createToken(t, jwt.SigningMethodHS256, []byte("first_secret"),
+				jwt.MapClaims{"iss": "https://evil.example.com", "aud": "api"}, nil),
+			expectError: "code=401, message=invalid or expired jwt, err=unexpected jwt issuer=https://evil.example.com",
+		},
+		{
+			name: "nok, token signed with key of other issuer",
+			whenToken: createToken(t, jwt.SigningMethodHS256, []byte("first_secret"),
+				jwt.MapClaims{"iss": "https://second.example.com"}, map[string]interface{}{"kid": "kid1"}),
+			expectError: "code=401, message=invalid or expired jwt, err=token signature is invalid: signing method HS256 is invalid",
+		},
+		{
+			name: "nok, audience mismatch",
+			whenToken: createToken(t, jwt.SigningMethodHS256, []byte("first_secret"),
+				jwt.MapClaims{"iss": "https://first.example.com", "aud": "other"}, nil),
+			expectError: "code=401, message=invalid or expired jwt, err=token has invalid claims: token has invalid audience",
+		},
+		{
+			name:        "nok, malformed token",
+			whenToken:   "x.x.x",
+			expectError: "code=401, message=invalid or expired jwt, err=token is malformed: could not base64 decode header: illegal base64 data at input byte 0",
+		},
+	}
+
+	mw, err := Config{Issuers: issuers}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.whenToken)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+
+			err := mw(func(c *echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+
+			token := c.Get("user").(*jwt.Token)
+			switch claims := token.Claims.(type) {
+			case jwt.MapClaims:
+				assert.Equal(t, tc.expectName, claims["name"])
+			case *jwtCustomClaims:
+				assert.Equal(t, tc.expectName, claims.Name)
+			default:
+				t.Fatalf("unexpected type of claims: %T", claims)
+			}
+		})
+	}
+}
+
+func TestConfig_Issuers_invalidConfig(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		given       []IssuerProfile
+		expectError string
+	}{
+		{
+			name:        "nok, missing issuer",
+			given:       []IssuerProfile{{SigningKey: []byte("secret")}},
+			expectError: "jwt middleware issuer profile requires issuer",
+		},
+		{
+			name:        "nok, missing signing key",
+			given:       []IssuerProfile{{Issuer: "a"}},
+			expectError: "jwt middleware issuer profile requires signing key: a",
+		},
+		{
+			name:        "nok, duplicate issuer",
+			given:       []IssuerProfile{{Issuer: "a", SigningKey: []byte("x")}, {Issuer: "a", SigningKey: []byte("y")}},
+			expectError: "jwt middleware has duplicate issuer profile: a",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Config{Issuers: tc.given}.ToMiddleware()
+			assert.EqualError(t, err, tc.expectError)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksMaxResponseSize limits size of JWKS response body. This limits possible resource exhaustion attack vector
+const jwksMaxResponseSize = 1 << 20
+
+// JWKSKeyProviderConfig defines the config for JWKSKeyProvider.
+type JWKSKeyProviderConfig struct {
+	// URL is URL of JSON Web Key Set document, i.e. `jwks_uri` of OpenID Connect provider.
+	// Required.
+	URL string
+
+	// Client is HTTP client used to fetch the key set.
+	// Optional. Default value client with 10 second timeout.
+	Client *http.Client
+
+	// RefreshInterval is interval how often key set is refreshed by Watch.
+	// Optional. Default value 1 hour.
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval is minimal interval between refreshes caused by tokens with unknown `kid`. This limits number
+	// of requests to the URL when tokens signed with unknown keys are sent.
+	// Optional. Default value 1 minute.
+	MinRefreshInterval time.Duration
+
+	// RefreshTimeout limits duration of refresh caused by token with unknown `kid`. Token verification waits for
+	// the refresh, so this limits the latency added to the request.
+	// Optional. Default value 5 seconds.
+	RefreshTimeout time.Duration
+
+	// ErrorHandler is called when key set could not be fetched or parsed. Provider keeps serving the last good keys.
+	// Optional.
+	ErrorHandler func(err error)
+}
+
+// JWKSKeyProvider provides token verification keys from JSON Web Key Set fetched from URL. Key set is refreshed
+// periodically by Watch and when token with unknown `kid` is verified, so keys rotated by the identity provider are
+// picked up without restart. When the key set can not be fetched the last good keys are kept.
+//
+// Use KeyFunc method as Config.KeyFunc and run Watch in a separate goroutine.
+type JWKSKeyProvider struct {
+	config JWKSKeyProviderConfig
+
+	keys atomic.Pointer[fileKeys]
+
+	mu        sync.Mutex // guards fetchedAt and inflight
+	fetchedAt time.Time
+	inflight  chan struct{} // closed when refresh caused by unknown `kid` is done
+}
+
+// NewJWKSKeyProvider creates JWKSKeyProvider and fetches the key set. Returns an error when key set can not be fetched
+// or parsed.
+func NewJWKSKeyProvider(ctx context.Context, config JWKSKeyProviderConfig) (*JWKSKeyProvider, error) {
+	if config.URL == "" {
+		return nil, errors.New("jwt jwks key provider requires url")
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Hour
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = time.Minute
+	}
+	if config.RefreshTimeout <= 0 {
+		config.RefreshTimeout = 5 * time.Second
+	}
+	p := &JWKSKeyProvider{config: config}
+	if err := p.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Watch refreshes the key set every RefreshInterval. Watch blocks until context is cancelled.
+func (p *JWKSKeyProvider) Watch(ctx context.Context) {
+	ticker := time.NewTicker(p.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Refresh(ctx); err != nil && p.config.ErrorHandler != nil {
+				p.config.ErrorHandler(err)
+			}
+		}
+	}
+}
+
+// Refresh fetches the key set. On error the last good keys are kept.
+func (p *JWKSKeyProvider) Refresh(ctx context.Context) error {
+	p.mu.Lock()
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+	return p.refresh(ctx)
+}
+
+// refresh fetches the key set and replaces keys. It is called without holding the lock so verification of tokens is
+// not blocked by the network request.
+func (p *JWKSKeyProvider) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.URL, nil)
+	if err != nil {
+		return fmt.Errorf("jwt jwks key provider failed to fetch %v: %w", p.config.URL, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("jwt jwks key provider failed to fetch %v: %w", p.config.URL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwt jwks key provider failed to fetch %v: unexpected status code %d", p.config.URL, res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, jwksMaxResponseSize+1))
+	if err != nil {
+		return fmt.Errorf("jwt jwks key provider failed to fetch %v: %w", p.config.URL, err)
+	}
+	if len(data) > jwksMaxResponseSize {
+		return fmt.Errorf("jwt jwks key provider failed to fetch %v: response is too large", p.config.URL)
+	}
+	jwks, err := ParseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("jwt jwks key provider failed to parse %v: %w", p.config.URL, err)
+	}
+	p.keys.Store(newJWKSKeys(jwks))
+	return nil
+}
+
+// KeyFunc returns verification key for the token selected by token `kid` header. When key set does not contain the
+// key, key set is refreshed at most once per MinRefreshInterval. Token signing algorithm must match key type and JWK
+// `alg` parameter when present. Tokens with `crit` header are rejected.
+//
+// error returns TokenError.
+func (p *JWKSKeyProvider) KeyFunc(token *jwt.Token) (interface{}, error) {
+	keys := p.keys.Load()
+	if !keys.hasKeyID(token) {
+		keys = p.refreshForUnknownKey(token)
+	}
+	return keys.keyFunc(token)
+}
+
+// refreshForUnknownKey refreshes the key set unless it was refreshed less than MinRefreshInterval ago. Concurrent
+// calls wait for the single refresh in progress.
+func (p *JWKSKeyProvider) refreshForUnknownKey(token *jwt.Token) *fileKeys {
+	p.mu.Lock()
+	// key could be added by refresh in other goroutine while waiting for the lock
+	if keys := p.keys.Load(); keys.hasKeyID(token) {
+		p.mu.Unlock()
+		return keys
+	}
+	if inflight := p.inflight; inflight != nil {
+		p.mu.Unlock()
+		<-inflight
+		return p.keys.Load()
+	}
+	if time.Since(p.fetchedAt) < p.config.MinRefreshInterval {
+		p.mu.Unlock()
+		return p.keys.Load()
+	}
+	inflight := make(chan struct{})
+	p.inflight = inflight
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.RefreshTimeout)
+	err := p.refresh(ctx)
+	cancel()
+
+	p.mu.Lock()
+	p.inflight = nil
+	p.mu.Unlock()
+	close(inflight)
+
+	if err != nil && p.config.ErrorHandler != nil {
+		p.config.ErrorHandler(err)
+	}
+	return p.keys.Load()
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKSKeyProvider_KeyFunc(t *testing.T) {
+	idp := jwttest.NewIdP(t, jwttest.Key("RS256"), jwttest.Key("ES256"))
+
+	provider, err := NewJWKSKeyProvider(context.Background(), JWKSKeyProviderConfig{URL: idp.JWKSURL(), Client: idp.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := Config{KeyFunc: provider.KeyFunc}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name        string
+		whenToken   *jwttest.TokenBuilder
+		expectError string
+	}{
+		{
+			name:      "ok, RS256",
+			whenToken: idp.NewToken("RS256"),
+		},
+		{
+			name:      "ok, ES256",
+			whenToken: idp.NewToken("ES256"),
+		},
+		{
+			name:        "nok, unknown kid",
+			whenToken:   idp.NewToken("ES256").WrongKeyID(),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt key id=test-unknown-kid",
+		},
+		{
+			name:        "nok, algorithm does not match key alg",
+			whenToken:   idp.NewToken("PS256").KeyID("test-rs256"),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt signing method=PS256",
+		},
+		{
+			name:        "nok, signature",
+			whenToken:   idp.NewToken("ES256").TamperedSignature(),
+			expectError: "code=401, message=invalid or expired jwt, err=token signature is invalid: crypto/ecdsa: verification error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := serveWithToken(mw, tc.whenToken.MustSign(t))
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestJWKSKeyProvider_rotation(t *testing.T) {
+	idp := jwttest.NewIdP(t, jwttest.Key("RS256"))
+
+	var errs []error
+	provider, err := NewJWKSKeyProvider(context.Background(), JWKSKeyProviderConfig{
+		URL:                idp.JWKSURL(),
+		Client:             idp.Client(),
+		MinRefreshInterval: time.Hour,
+		ErrorHandler:       func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := Config{KeyFunc: provider.KeyFunc}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, idp.JWKSRequests())
+
+	// unknown kid is refreshed at most once per MinRefreshInterval
+	idp.SetKeys(jwttest.Key("RS256"), jwttest.Key("ES256"))
+	assert.Error(t, serveWithToken(mw, idp.NewToken("ES256").MustSign(t)))
+	assert.Equal(t, 1, idp.JWKSRequests())
+
+	assert.NoError(t, provider.Refresh(context.Background()))
+	assert.Equal(t, 2, idp.JWKSRequests())
+	assert.NoError(t, serveWithToken(mw, idp.NewToken("ES256").MustSign(t)))
+
+	// unknown kid triggers refresh after MinRefreshInterval has passed
+	provider.config.MinRefreshInterval = time.Nanosecond
+	idp.SetKeys(jwttest.Key("EdDSA"))
+	assert.NoError(t, serveWithToken(mw, idp.NewToken("EdDSA").MustSign(t)))
+	assert.Equal(t, 3, idp.JWKSRequests())
+	assert.Error(t, serveWithToken(mw, idp.NewToken("ES256").MustSign(t)))
+	assert.Empty(t, errs)
+}
+
+func TestJWKSKeyProvider_keepsKeysOnError(t *testing.T) {
+	jwks, err := json.Marshal(jwttest.JWKS(jwttest.Key("ES256")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	provider, err := NewJWKSKeyProvider(context.Background(), JWKSKeyProviderConfig{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := Config{KeyFunc: provider.KeyFunc}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status = http.StatusInternalServerError
+	err = provider.Refresh(context.Background())
+	assert.EqualError(t, err, "jwt jwks key provider failed to fetch "+server.URL+": unexpected status code 500")
+	assert.NoError(t, serveWithToken(mw, jwttest.NewToken("ES256").MustSign(t)))
+}
+
+func TestJWKSKeyProvider_refreshForUnknownKey(t *testing.T) {
+	jwks, err := json.Marshal(jwttest.JWKS(jwttest.Key("ES256")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var errs int32
+	provider, err := NewJWKSKeyProvider(context.Background(), JWKSKeyProviderConfig{
+		URL:                server.URL,
+		MinRefreshInterval: time.Hour,
+		RefreshTimeout:     100 * time.Millisecond,
+		ErrorHandler:       func(err error) { atomic.AddInt32(&errs, 1) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.fetchedAt = time.Time{}
+	mw, err := Config{KeyFunc: provider.KeyFunc}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Error(t, serveWithToken(mw, jwttest.NewToken("ES256").WrongKeyID().MustSign(t)))
+		}()
+	}
+	// tokens with known kid are verified while refresh is in progress
+	assert.NoError(t, serveWithToken(mw, jwttest.NewToken("ES256").MustSign(t)))
+	wg.Wait()
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&errs))
+	assert.NoError(t, serveWithToken(mw, jwttest.NewToken("ES256").MustSign(t)))
+}
+
+func TestNewJWKSKeyProvider_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			_, _ = w.Write([]byte(`{"keys":[],"x":"` + strings.Repeat("a", jwksMaxResponseSize) + `"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"unknown"}]}`))
+	}))
+	defer server.Close()
+
+	_, err := NewJWKSKeyProvider(context.Background(), JWKSKeyProviderConfig{})
+	assert.EqualError(t, err, "jwt jwks key provider requires url")
+
+	_, err = NewJWKSKeyProvider(context.Background(), JWKSKeyProviderConfig{URL: server.URL})
+	assert.EqualError(t, err, "jwt jwks key provider failed to parse "+server.URL+`: jwt key: invalid JWKS key at index 0: jwt key: unsupported JWK key type: "unknown"`)
+
+	_, err = NewJWKSKeyProvider(context.Background(), JWKSKeyProviderConfig{URL: server.URL + "/large"})
+	assert.EqualError(t, err, "jwt jwks key provider failed to fetch "+server.URL+"/large: response is too large")
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v5"
@@ -26,6 +27,17 @@ type Config struct {
 	// returns error.
 	SuccessHandler func(c *echo.Context) error
 
+	// AuditHandler defines a function which is executed for every request with a valid token, before SuccessHandler.
+	// It is also executed by the authenticator created with ToAuthenticator. Requests made with impersonation tokens
+	// are flagged with AuditEvent.Impersonated.
+	// Optional.
+	AuditHandler func(c *echo.Context, event AuditEvent)
+
+	// DetectImpersonation enables reading `impersonator` claim of impersonation tokens (see ImpersonationConfig) into
+	// Principal.Impersonator. Detection is always enabled when AuditHandler is set.
+	// Optional. Default value false.
+	DetectImpersonation bool
+
 	// ErrorHandler defines a function which is executed when all lookups have been done and none of them passed Validator
 	// function. ErrorHandler is executed with last missing (ErrExtractionValueMissing) or an invalid key.
 	// It may be used to define a custom JWT error.
@@ -42,14 +54,29 @@ type Config struct {
 	// and continue. Some logic down the remaining execution chain needs to check that (public) token value then.
 	ContinueOnIgnoredError bool
 
+	// Optional enables optional authentication. Request without token continues to the handler with anonymous
+	// Principal stored in context, while request with present but invalid token is still rejected with "401 -
+	// Unauthorized". ErrorHandler is not called for requests without token. Use IsAuthenticated in handlers to check
+	// if the request was authenticated.
+	// Optional. Default value false.
+	Optional bool
+
 	// Context key to store user information from the token into context.
 	// Optional. Default value "user".
 	ContextKey string
 
+	// PrincipalContextKey is context key to store Principal of the request under. PrincipalFromContext and middlewares
+	// reading Principal (Authorize, RateLimitWithConfig...) use the default key, so change it only when Principal is
+	// read with c.Get.
+	// Optional. Default value PrincipalContextKey ("echojwt.principal").
+	PrincipalContextKey string
+
 	// Signing key to validate token.
 	// This is one of the three options to provide a token validation key.
 	// The order of precedence is a user-defined KeyFunc, SigningKeys and SigningKey.
 	// Required if neither user-defined KeyFunc nor SigningKeys is provided.
+	// Key type must match SigningMethod: []byte for HS*, *rsa.PublicKey for RS* and PS*, *ecdsa.PublicKey for ES* and
+	// ed25519.PublicKey for EdDSA. Use ParsePublicKeyPEM, ParseJWK, LoadPublicKeyFile etc. to load keys.
 	SigningKey interface{}
 
 	// Map of signing keys to validate token with kid field usage.
@@ -58,6 +85,13 @@ type Config struct {
 	// Required if neither user-defined KeyFunc nor SigningKey is provided.
 	SigningKeys map[string]interface{}
 
+	// KeySet is map of signing keys by key id (kid field) with per key metadata: algorithm, intended use and
+	// activation and retirement time. Keys outside their activation window are not used, so keys can be rotated
+	// in and phased out without redeploying the configuration.
+	// This is an alternative to SigningKeys option to provide token validation keys.
+	// The order of precedence is a user-defined KeyFunc, KeySet, SigningKeys and SigningKey.
+	KeySet KeySet
+
 	// Signing method used to check the token's signing algorithm.
 	// SigningMethod is not checked when a user-defined KeyFunc is provided.
 	// Optional. Default value HS256.
@@ -89,7 +123,16 @@ type Config struct {
 	// - "query:<name>"
 	// - "param:<name>"
 	// - "cookie:<name>"
+	// - "chunkedcookie:<name>"
+	//			token is joined from cookies `<name>.0`, `<name>.1`, ... written by SetChunkedCookie. Falls back to
+	//			cookie `<name>` when there are no chunks. See ValuesFromChunkedCookie.
 	// - "form:<name>"
+	// - "json:<path>"
+	//			token is taken from JSON request body field at dot separated `<path>`, for example "json:auth.token".
+	//			Body is limited to DefaultJSONBodyLimit bytes and restored for the handler. See ValuesFromJSONBody.
+	// - "websocket:<prefix>"
+	//			token is taken from WebSocket upgrade request `Sec-WebSocket-Protocol` header subprotocol starting with
+	//			`<prefix>`. See ValuesFromWebSocketProtocol.
 	// Multiple sources example:
 	// - "header:Authorization:Bearer ,cookie:myowncookie"
 	TokenLookup string
@@ -109,6 +152,49 @@ type Config struct {
 	// Not used if custom ParseTokenFunc is set.
 	// Optional. Defaults to function returning jwt.MapClaims
 	NewClaimsFunc func(c *echo.Context) jwt.Claims
+
+	// ParserOptions are options of the JWT parser used by default ParseTokenFunc implementation, for example
+	// jwt.WithIssuer, jwt.WithAudience or jwt.WithLeeway.
+	// Not used if custom ParseTokenFunc, Issuers or TenantResolver is set.
+	// Optional.
+	ParserOptions []jwt.ParserOption
+
+	// Issuers defines validation profiles for tokens coming from multiple issuers. Middleware reads the unverified
+	// `iss` claim from the token, selects the profile with matching Issuer and validates the token only with keys,
+	// algorithms, audience and claims type of that profile. Tokens from issuers not in the list are rejected.
+	//
+	// When Issuers is set, SigningKey, SigningKeys, SigningMethod, KeyFunc and NewClaimsFunc are ignored.
+	// This is an alternative to SigningKey, SigningKeys and KeyFunc options to provide token validation keys.
+	// Not used if custom ParseTokenFunc is set.
+	Issuers []IssuerProfile
+
+	// TenantResolver resolves tenant of the request (from subdomain, path param, header etc.). When set, token is
+	// validated with the tenant profile returned by TenantProfileFunc and the token TenantClaim must match the
+	// resolved tenant, so token issued for one tenant can not be used for another tenant.
+	//
+	// When TenantResolver is set, SigningKey, SigningKeys, SigningMethod, KeyFunc and NewClaimsFunc are ignored.
+	// Can not be used together with Issuers. Not used if custom ParseTokenFunc is set.
+	TenantResolver TenantResolver
+
+	// TenantProfileFunc loads token validation profile for the tenant. Profiles are loaded lazily on first request of the
+	// tenant and cached for the lifetime of the middleware, up to 1000 least recently used tenants. Errors are not cached.
+	// Required when TenantResolver is set.
+	TenantProfileFunc TenantProfileFunc
+
+	// TenantClaim is name of the token claim containing tenant identifier.
+	// Optional. Default value "tenant".
+	TenantClaim string
+
+	// PrincipalMapping defines token claims Principal subject, tenant, roles, scopes and email are read from, for example
+	// `realm_access.roles` or `https://example.com/roles`. Principal is stored in context under PrincipalContextKey next
+	// to the token.
+	// Optional. When not set only Principal.Subject is read from `sub` claim.
+	PrincipalMapping *PrincipalMapping
+
+	// RoutePolicies are per route overrides of this Config by route name, for example different audience, additional
+	// required claims or optional authentication. Requests of routes without policy are validated with this Config.
+	// Optional.
+	RoutePolicies RoutePolicies
 }
 
 const (
@@ -144,12 +230,15 @@ type TokenExtractionError struct {
 }
 
 // Is checks if target error is same as TokenExtractionError
-func (e TokenExtractionError) Is(target error) bool { return target == ErrJWTMissing } // to provide some compatibility with older error handling logic
+func (e TokenExtractionError) Is(target error) bool {
+	return target == ErrJWTMissing || target == ErrorKindMissing // ErrJWTMissing to provide some compatibility with older error handling logic
+}
 
 func (e *TokenExtractionError) Error() string { return e.Err.Error() }
 func (e *TokenExtractionError) Unwrap() error { return e.Err }
 
-// TokenError is used to return error with error occurred JWT token when processing JWT token
+// TokenError is used to return error with error occurred JWT token when processing JWT token. Kind method classifies
+// the error.
 type TokenError struct {
 	Token *jwt.Token
 	Err   error
@@ -185,40 +274,11 @@ func WithConfig(config Config) echo.MiddlewareFunc {
 
 // ToMiddleware converts Config to middleware or returns an error for invalid configuration
 func (config Config) ToMiddleware() (echo.MiddlewareFunc, error) {
-	if config.Skipper == nil {
-		config.Skipper = middleware.DefaultSkipper
-	}
-	if config.ContextKey == "" {
-		config.ContextKey = "user"
-	}
-	if config.TokenLookup == "" && len(config.TokenLookupFuncs) == 0 {
-		config.TokenLookup = "header:Authorization:Bearer "
-	}
-	if config.SigningMethod == "" {
-		config.SigningMethod = AlgorithmHS256
-	}
-
-	if config.NewClaimsFunc == nil {
-		config.NewClaimsFunc = func(c *echo.Context) jwt.Claims {
-			return jwt.MapClaims{}
-		}
-	}
-	if config.SigningKey == nil && len(config.SigningKeys) == 0 && config.KeyFunc == nil && config.ParseTokenFunc == nil {
-		return nil, errors.New("jwt middleware requires signing key")
-	}
-	if config.KeyFunc == nil {
-		config.KeyFunc = config.defaultKeyFunc
-	}
-	if config.ParseTokenFunc == nil {
-		config.ParseTokenFunc = config.defaultParseTokenFunc
-	}
-	extractors, ceErr := middleware.CreateExtractors(config.TokenLookup, 1)
-	if ceErr != nil {
-		return nil, ceErr
-	}
-	if len(config.TokenLookupFuncs) > 0 {
-		extractors = append(config.TokenLookupFuncs, extractors...)
+	a, err := config.newAuthenticator()
+	if err != nil {
+		return nil, err
 	}
+	config = a.config
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c *echo.Context) error {
@@ -229,29 +289,21 @@ func (config Config) ToMiddleware() (echo.MiddlewareFunc, error) {
 			if config.BeforeFunc != nil {
 				config.BeforeFunc(c)
 			}
-			var lastExtractorErr error
-			var lastTokenErr error
-			for _, extractor := range extractors {
-				auths, _, extrErr := extractor(c)
-				if extrErr != nil {
-					lastExtractorErr = extrErr
-					continue
-				}
-				for _, auth := range auths {
-					token, err := config.ParseTokenFunc(c, auth)
-					if err != nil {
-						lastTokenErr = err
-						continue
+			parseToken, optional := a.routePolicy(c)
+			principal, lastTokenErr, lastExtractorErr := a.authenticate(c, parseToken)
+			if principal != nil {
+				c.Set(config.PrincipalContextKey, principal)
+				if config.SuccessHandler != nil {
+					if sErr := config.SuccessHandler(c); sErr != nil {
+						return sErr
 					}
-					// Store user information from token into context.
-					c.Set(config.ContextKey, token)
-					if config.SuccessHandler != nil {
-						if sErr := config.SuccessHandler(c); sErr != nil {
-							return sErr
-						}
-					}
-					return next(c)
 				}
+				return next(c)
+			}
+
+			if optional && lastTokenErr == nil {
+				c.Set(config.PrincipalContextKey, newAnonymousPrincipal())
+				return next(c)
 			}
 
 			// prioritize token errors over extracting errors as parsing is occurs further in process, meaning we managed to
@@ -279,35 +331,246 @@ func (config Config) ToMiddleware() (echo.MiddlewareFunc, error) {
 	}, nil
 }
 
+// ToAuthenticator converts Config to Authenticator to be used with AuthChain or returns an error for invalid
+// configuration. Authenticator stores valid token in context under ContextKey and calls AuditHandler. Skipper,
+// BeforeFunc, SuccessHandler, ErrorHandler, ContinueOnIgnoredError and Optional are not used by the authenticator.
+func (config Config) ToAuthenticator() (Authenticator, error) {
+	return config.newAuthenticator()
+}
+
+// jwtAuthenticator extracts and validates tokens with Config that has defaults already applied.
+type jwtAuthenticator struct {
+	config        Config
+	extractors    []middleware.ValuesExtractor
+	routePolicies map[string]routePolicy
+
+	principalMapper *principalMapper
+}
+
+// newAuthenticator applies defaults to config and validates it.
+func (config Config) newAuthenticator() (*jwtAuthenticator, error) {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if config.PrincipalContextKey == "" {
+		config.PrincipalContextKey = PrincipalContextKey
+	}
+	if config.TokenLookup == "" && len(config.TokenLookupFuncs) == 0 {
+		config.TokenLookup = "header:Authorization:Bearer "
+	}
+	if config.SigningMethod == "" {
+		config.SigningMethod = AlgorithmHS256
+	}
+
+	if config.NewClaimsFunc == nil {
+		config.NewClaimsFunc = func(c *echo.Context) jwt.Claims {
+			return jwt.MapClaims{}
+		}
+	}
+	if config.SigningKey == nil && len(config.SigningKeys) == 0 && len(config.KeySet) == 0 && config.KeyFunc == nil &&
+		config.ParseTokenFunc == nil && len(config.Issuers) == 0 && config.TenantResolver == nil {
+		return nil, errors.New("jwt middleware requires signing key")
+	}
+	if len(config.Issuers) > 0 && config.TenantResolver != nil {
+		return nil, errors.New("jwt middleware can not use both Issuers and TenantResolver")
+	}
+	extractors, ceErr := createExtractors(config.TokenLookup)
+	if ceErr != nil {
+		return nil, ceErr
+	}
+	if len(config.TokenLookupFuncs) > 0 {
+		extractors = append(config.TokenLookupFuncs, extractors...)
+	}
+	if config.KeyFunc == nil && config.ParseTokenFunc == nil && len(config.Issuers) == 0 && config.TenantResolver == nil {
+		if err := config.validateSigningKeys(); err != nil {
+			return nil, err
+		}
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = config.defaultKeyFunc
+	}
+	isDefaultParser := config.ParseTokenFunc == nil
+	if config.ParseTokenFunc == nil && config.TenantResolver != nil {
+		tenants, err := newTenantParsers(config.TenantResolver, config.TenantProfileFunc, config.TenantClaim)
+		if err != nil {
+			return nil, err
+		}
+		config.ParseTokenFunc = tenants.parseToken
+	}
+	if config.ParseTokenFunc == nil && len(config.Issuers) > 0 {
+		issuers, err := newIssuerParsers(config.Issuers)
+		if err != nil {
+			return nil, err
+		}
+		config.ParseTokenFunc = issuers.parseToken
+	}
+	if config.ParseTokenFunc == nil {
+		config.ParseTokenFunc = config.defaultParseTokenFunc
+	}
+	routePolicies, err := newRoutePolicies(config, isDefaultParser)
+	if err != nil {
+		return nil, err
+	}
+	a := &jwtAuthenticator{config: config, extractors: extractors, routePolicies: routePolicies}
+	if config.PrincipalMapping != nil {
+		if a.principalMapper, err = newPrincipalMapper(*config.PrincipalMapping); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Authenticate implements Authenticator interface. Error is TokenParsingError when token was extracted but is not
+// valid, otherwise TokenExtractionError or ErrorKindMissing.
+func (a *jwtAuthenticator) Authenticate(c *echo.Context) (*Principal, error) {
+	parseToken, _ := a.routePolicy(c)
+	principal, tokenErr, extractorErr := a.authenticate(c, parseToken)
+	switch {
+	case principal != nil:
+		return principal, nil
+	case tokenErr != nil:
+		return nil, &TokenParsingError{Err: tokenErr}
+	case extractorErr != nil:
+		return nil, &TokenExtractionError{Err: extractorErr}
+	}
+	return nil, ErrorKindMissing
+}
+
+// routePolicy returns ParseTokenFunc and optional authentication mode for the route of the request.
+func (a *jwtAuthenticator) routePolicy(c *echo.Context) (func(c *echo.Context, auth string) (interface{}, error), bool) {
+	if len(a.routePolicies) > 0 {
+		if policy, ok := a.routePolicies[routeName(c)]; ok {
+			return policy.parseToken, a.config.Optional || policy.optional
+		}
+	}
+	return a.config.ParseTokenFunc, a.config.Optional
+}
+
+// authenticate extracts token from the request and parses it. Valid token is stored in context and principal of the
+// token is returned. Otherwise last token parsing and last extractor errors are returned.
+func (a *jwtAuthenticator) authenticate(
+	c *echo.Context,
+	parseToken func(c *echo.Context, auth string) (interface{}, error),
+) (principal *Principal, lastTokenErr error, lastExtractorErr error) {
+	for _, extractor := range a.extractors {
+		auths, source, extrErr := extractor(c)
+		if extrErr != nil {
+			lastExtractorErr = extrErr
+			continue
+		}
+		for _, auth := range auths {
+			token, p, err := a.parse(c, parseToken, auth)
+			if err != nil {
+				lastTokenErr = err
+				continue
+			}
+			// Store user information from token into context.
+			c.Set(a.config.ContextKey, token)
+			if source == ExtractorSourceWebSocketProtocol {
+				selectWebSocketProtocol(c, auth)
+			}
+			if a.config.AuditHandler != nil {
+				a.config.AuditHandler(c, AuditEvent{Principal: p, Impersonated: p.IsImpersonated()})
+			}
+			return p, nil, nil
+		}
+	}
+	return nil, lastTokenErr, lastExtractorErr
+}
+
+// parse parses the token and creates principal of the token.
+func (a *jwtAuthenticator) parse(
+	c *echo.Context,
+	parseToken func(c *echo.Context, auth string) (interface{}, error),
+	auth string,
+) (interface{}, *Principal, error) {
+	token, err := parseToken(c, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	var principal *Principal
+	if a.principalMapper != nil {
+		principal = a.principalMapper.principal(token)
+	} else {
+		principal = newTokenPrincipal(token)
+	}
+	if a.config.DetectImpersonation || a.config.AuditHandler != nil {
+		principal.Impersonator = tokenImpersonator(token)
+	}
+	return token, principal, nil
+}
+
+// validateSigningKeys checks that KeySet, SigningKeys and SigningKey types match their signing method.
+func (config Config) validateSigningKeys() error {
+	if len(config.KeySet) > 0 {
+		return config.KeySet.validate(config.SigningMethod)
+	}
+	if len(config.SigningKeys) == 0 {
+		return validateSigningKey(config.SigningMethod, config.SigningKey)
+	}
+	for kid, key := range config.SigningKeys {
+		if err := validateSigningKey(config.SigningMethod, key); err != nil {
+			return fmt.Errorf("%w, key id=%v", err, kid)
+		}
+	}
+	return nil
+}
+
 // defaultKeyFunc creates JWTGo implementation for KeyFunc.
 //
 // error returns TokenError.
 func (config Config) defaultKeyFunc(token *jwt.Token) (interface{}, error) {
+	if len(config.KeySet) > 0 {
+		return config.KeySet.lookup(token, config.SigningMethod, time.Now())
+	}
 	if token.Method.Alg() != config.SigningMethod {
-		return nil, &TokenError{Token: token, Err: fmt.Errorf("unexpected jwt signing method=%v", token.Header["alg"])}
+		return nil, &TokenError{Token: token, Err: errUnexpectedSigningMethod(token)}
 	}
-	if len(config.SigningKeys) == 0 {
-		return config.SigningKey, nil
+	return lookupKey(token, config.SigningKey, config.SigningKeys)
+}
+
+// lookupKey returns signingKey when signingKeys is empty, otherwise key from signingKeys matching token `kid` header.
+//
+// error returns TokenError.
+func lookupKey(token *jwt.Token, signingKey interface{}, signingKeys map[string]interface{}) (interface{}, error) {
+	if len(signingKeys) == 0 {
+		return signingKey, nil
 	}
 
 	if kid, ok := token.Header["kid"].(string); ok {
-		if key, ok := config.SigningKeys[kid]; ok {
+		if key, ok := signingKeys[kid]; ok {
 			return key, nil
 		}
 	}
-	return nil, &TokenError{Token: token, Err: fmt.Errorf("unexpected jwt key id=%v", token.Header["kid"])}
+	return nil, &TokenError{Token: token, Err: errUnexpectedKeyID(token)}
 }
 
 // defaultParseTokenFunc creates JWTGo implementation for ParseTokenFunc.
 //
 // error returns TokenError.
 func (config Config) defaultParseTokenFunc(c *echo.Context, auth string) (interface{}, error) {
-	token, err := jwt.ParseWithClaims(auth, config.NewClaimsFunc(c), config.KeyFunc)
+	token, err := jwt.NewParser(config.ParserOptions...).ParseWithClaims(auth, config.NewClaimsFunc(c), config.KeyFunc)
 	if err != nil {
 		return nil, &TokenError{Token: token, Err: err}
 	}
 	if !token.Valid {
 		return nil, &TokenError{Token: token, Err: errors.New("invalid token")}
 	}
+	if err := checkCriticalHeader(token); err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
 	return token, nil
 }
+
+// checkCriticalHeader rejects tokens with `crit` header. Recipient must reject token when it does not understand any of
+// the critical extensions (RFC 7515 section 4.1.11) and none of the extensions are supported. The underlying JWT library
+// does not check the header.
+func checkCriticalHeader(token *jwt.Token) error {
+	if crit, ok := token.Header["crit"]; ok {
+		return fmt.Errorf("unsupported jwt critical header=%v", crit)
+	}
+	return nil
+}
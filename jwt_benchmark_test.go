@@ -66,3 +66,38 @@ func BenchmarkJWTErrorPath(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkJWTSuccessPath_customClaims(b *testing.B) {
+	e := echo.New()
+
+	e.GET("/", func(c *echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	b.ReportAllocs()
+	mw, err := Config{
+		SigningKey:    []byte("secret"),
+		NewClaimsFunc: func(c *echo.Context) jwt.Claims { return &jwt.RegisteredClaims{} },
+	}.ToMiddleware()
+	if err != nil {
+		b.Fatal(err)
+	}
+	e.Use(mw)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1234567890", "name": "John Doe"}).SignedString([]byte("secret"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		res := httptest.NewRecorder()
+
+		e.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			b.Fatal(res.Code)
+		}
+	}
+}
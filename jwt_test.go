@@ -4,6 +4,8 @@
 package echojwt
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"net/http"
@@ -78,6 +80,10 @@ func TestJWT_combinations(t *testing.T) {
 	validKey := []byte("secret")
 	invalidKey := []byte("invalid-key")
 	validAuth := "Bearer " + token
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	var testCases = []struct {
 		name                    string
@@ -94,6 +100,22 @@ func TestJWT_combinations(t *testing.T) {
 			name:                    "No signing key provided",
 			expectToMiddlewareError: "jwt middleware requires signing key",
 		},
+		{
+			name: "Signing key type does not match signing method",
+			config: Config{
+				SigningKey:    "secret",
+				SigningMethod: AlgorithmHS256,
+			},
+			expectToMiddlewareError: "jwt signing key type string does not match signing method HS256, expected []byte",
+		},
+		{
+			name: "Signing keys type does not match signing method",
+			config: Config{
+				SigningKeys:   map[string]interface{}{"kid1": validKey},
+				SigningMethod: "RS256",
+			},
+			expectToMiddlewareError: "jwt signing key type []uint8 does not match signing method RS256, expected *rsa.PublicKey, key id=kid1",
+		},
 		{
 			name: "invalid TokenLookup",
 			config: Config{
@@ -107,7 +129,7 @@ func TestJWT_combinations(t *testing.T) {
 			name:    "Unexpected signing method",
 			hdrAuth: validAuth,
 			config: Config{
-				SigningKey:    validKey,
+				SigningKey:    &rsaKey.PublicKey,
 				SigningMethod: "RS256",
 			},
 			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt signing method=HS256",
@@ -898,3 +920,15 @@ func TestDataRacesOnParallelExecution(t *testing.T) {
 		})
 	}
 }
+
+func createToken(t testing.TB, method jwt.SigningMethod, key interface{}, claims jwt.Claims, header map[string]interface{}) string {
+	token := jwt.NewWithClaims(method, claims)
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
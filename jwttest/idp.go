@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package jwttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	// DiscoveryPath is path of OpenID Connect discovery document served by IdP.
+	DiscoveryPath = "/.well-known/openid-configuration"
+	// JWKSPath is path of JWKS document served by IdP.
+	JWKSPath = "/.well-known/jwks.json"
+)
+
+// IdP is fake identity provider backed by httptest.Server. It serves OpenID Connect discovery document at
+// DiscoveryPath and public keys of its signing keys as JWKS at JWKSPath. Issuer of the IdP is the server URL.
+type IdP struct {
+	server *httptest.Server
+
+	mu   sync.RWMutex
+	keys []KeyPair
+
+	jwksRequests atomic.Int64
+}
+
+// NewIdP starts fake identity provider signing with given keys. Without keys all AsymmetricKeys are used. Server is
+// closed when the test finishes.
+func NewIdP(t testing.TB, keys ...KeyPair) *IdP {
+	t.Helper()
+	if len(keys) == 0 {
+		keys = AsymmetricKeys()
+	}
+	idp := &IdP{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc(DiscoveryPath, idp.serveDiscovery)
+	mux.HandleFunc(JWKSPath, idp.serveJWKS)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// URL returns base URL of the server.
+func (idp *IdP) URL() string {
+	return idp.server.URL
+}
+
+// Issuer returns issuer identifier of the IdP (`iss` claim of tokens it creates).
+func (idp *IdP) Issuer() string {
+	return idp.server.URL
+}
+
+// JWKSURL returns URL of JWKS document.
+func (idp *IdP) JWKSURL() string {
+	return idp.server.URL + JWKSPath
+}
+
+// DiscoveryURL returns URL of OpenID Connect discovery document.
+func (idp *IdP) DiscoveryURL() string {
+	return idp.server.URL + DiscoveryPath
+}
+
+// Client returns HTTP client configured to talk to the server.
+func (idp *IdP) Client() *http.Client {
+	return idp.server.Client()
+}
+
+// JWKSRequests returns number of JWKS document requests served so far. Useful for testing key caching.
+func (idp *IdP) JWKSRequests() int {
+	return int(idp.jwksRequests.Load())
+}
+
+// SetKeys replaces signing keys of the IdP, simulating key rotation.
+func (idp *IdP) SetKeys(keys ...KeyPair) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys = keys
+}
+
+// Keys returns current signing keys of the IdP.
+func (idp *IdP) Keys() []KeyPair {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+	return append([]KeyPair(nil), idp.keys...)
+}
+
+// NewToken creates builder for token signed with IdP key of the algorithm and `iss` claim set to the IdP issuer.
+// Key of the algorithm does not need to be published by the IdP, this way tokens signed with unknown keys can be
+// created.
+func (idp *IdP) NewToken(alg string) *TokenBuilder {
+	return NewToken(alg).Issuer(idp.Issuer())
+}
+
+func (idp *IdP) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	algs := make([]string, 0)
+	for _, k := range idp.Keys() {
+		algs = append(algs, k.Algorithm)
+	}
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                idp.Issuer(),
+		"jwks_uri":                              idp.JWKSURL(),
+		"id_token_signing_alg_values_supported": algs,
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+	})
+}
+
+func (idp *IdP) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	idp.jwksRequests.Add(1)
+	writeJSON(w, JWKS(idp.Keys()...))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// JWKS returns JWKS document with public keys of given key pairs. Symmetric keys are never included.
+func JWKS(keys ...KeyPair) map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(keys))
+	for _, k := range keys {
+		if jwk := k.JWK(); jwk != nil {
+			result = append(result, jwk)
+		}
+	}
+	return map[string]interface{}{"keys": result}
+}
+
+// JWK returns public key of the key pair as JWK (RFC 7517) with `kid`, `alg` and `use` parameters. Returns nil for
+// symmetric keys.
+func (k KeyPair) JWK() map[string]interface{} {
+	jwk := map[string]interface{}{"kid": k.KeyID, "alg": k.Algorithm, "use": "sig"}
+	switch pub := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = encodeJWKParam(pub.N.Bytes())
+		jwk["e"] = encodeJWKParam(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, err := pub.Bytes()
+		if err != nil {
+			return nil
+		}
+		size := (len(point) - 1) / 2
+		jwk["kty"] = "EC"
+		jwk["crv"] = pub.Curve.Params().Name
+		jwk["x"] = encodeJWKParam(point[1 : 1+size])
+		jwk["y"] = encodeJWKParam(point[1+size:])
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = encodeJWKParam(pub)
+	default:
+		return nil
+	}
+	return jwk
+}
+
+func encodeJWKParam(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
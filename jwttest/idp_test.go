@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package jwttest_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	echojwt "github.com/labstack/echo-jwt/v5"
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdP(t *testing.T) {
+	idp := jwttest.NewIdP(t)
+
+	var discovery struct {
+		Issuer  string   `json:"issuer"`
+		JWKSURI string   `json:"jwks_uri"`
+		Algs    []string `json:"id_token_signing_alg_values_supported"`
+	}
+	assert.NoError(t, json.Unmarshal(get(t, idp.Client(), idp.DiscoveryURL()), &discovery))
+	assert.Equal(t, idp.Issuer(), discovery.Issuer)
+	assert.Equal(t, idp.JWKSURL(), discovery.JWKSURI)
+	assert.Contains(t, discovery.Algs, "RS256")
+	assert.NotContains(t, discovery.Algs, "HS256")
+
+	jwks, err := echojwt.ParseJWKS(get(t, idp.Client(), discovery.JWKSURI))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, idp.JWKSRequests())
+
+	mw, err := echojwt.Config{KeySet: jwks.KeySet()}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range jwttest.AsymmetricKeys() {
+		t.Run(k.Algorithm, func(t *testing.T) {
+			assert.NoError(t, serve(mw, idp.NewToken(k.Algorithm).MustSign(t)))
+		})
+	}
+	assert.Error(t, serve(mw, idp.NewToken("HS256").MustSign(t)))
+}
+
+func TestIdP_SetKeys(t *testing.T) {
+	idp := jwttest.NewIdP(t, jwttest.Key("RS256"))
+	idp.SetKeys(jwttest.Key("ES256"))
+
+	jwks, err := echojwt.ParseJWKS(get(t, idp.Client(), idp.JWKSURL()))
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "test-es256", jwks.Keys[0].KeyID)
+}
+
+func get(t *testing.T, client *http.Client, url string) []byte {
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func serve(mw echo.MiddlewareFunc, token string) error {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	return mw(func(c *echo.Context) error { return nil })(c)
+}
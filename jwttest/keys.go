@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+// Package jwttest provides helpers for testing code protected by the echojwt middleware: deterministic key pairs for
+// every supported signing algorithm, fluent token builder and fake identity provider serving JWKS and OpenID Connect
+// discovery documents.
+//
+// Keys in this package are published in source code. Never use them outside of tests.
+package jwttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"embed"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//go:embed keys/*.pem
+var keyFiles embed.FS
+
+// Algorithms lists all signing algorithms test keys are available for.
+var Algorithms = []string{
+	"HS256", "HS384", "HS512",
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// KeyPair is test key pair for single signing algorithm.
+type KeyPair struct {
+	// Algorithm is the signing algorithm the key is meant for (`alg` header).
+	Algorithm string
+
+	// KeyID is key identifier (`kid` header). Deterministic, for example "test-rs256".
+	KeyID string
+
+	// PrivateKey is token signing key. For HMAC algorithms it is the shared secret.
+	PrivateKey interface{}
+
+	// PublicKey is token verification key, the value to use as echojwt.Config SigningKey. For HMAC algorithms it is
+	// the shared secret.
+	PublicKey interface{}
+}
+
+// IsSymmetric returns true for HMAC keys that must not be published in JWKS.
+func (k KeyPair) IsSymmetric() bool {
+	return strings.HasPrefix(k.Algorithm, "HS")
+}
+
+var (
+	keysOnce sync.Once
+	keys     map[string]KeyPair
+)
+
+// Key returns deterministic test key pair for the signing algorithm. Same algorithm always returns the same key. RSA
+// algorithms (RS* and PS*) share single 2048 bit key, ES* algorithms use key on the matching curve.
+//
+// Panics for unsupported algorithm.
+func Key(alg string) KeyPair {
+	keysOnce.Do(loadKeys)
+	k, ok := keys[alg]
+	if !ok {
+		panic(fmt.Sprintf("jwttest: no test key for signing algorithm %v", alg))
+	}
+	return k
+}
+
+// Keys returns test key pairs for all Algorithms.
+func Keys() []KeyPair {
+	result := make([]KeyPair, 0, len(Algorithms))
+	for _, alg := range Algorithms {
+		result = append(result, Key(alg))
+	}
+	return result
+}
+
+// AsymmetricKeys returns test key pairs for all public key algorithms.
+func AsymmetricKeys() []KeyPair {
+	result := make([]KeyPair, 0, len(Algorithms))
+	for _, k := range Keys() {
+		if !k.IsSymmetric() {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+func loadKeys() {
+	rsaKey := mustLoadKey("rsa.pem").(*rsa.PrivateKey)
+	p256 := mustLoadKey("p256.pem").(*ecdsa.PrivateKey)
+	p384 := mustLoadKey("p384.pem").(*ecdsa.PrivateKey)
+	p521 := mustLoadKey("p521.pem").(*ecdsa.PrivateKey)
+	edKey := mustLoadKey("ed25519.pem").(ed25519.PrivateKey)
+
+	keys = make(map[string]KeyPair, len(Algorithms))
+	add := func(alg string, private interface{}, public interface{}) {
+		keys[alg] = KeyPair{Algorithm: alg, KeyID: "test-" + strings.ToLower(alg), PrivateKey: private, PublicKey: public}
+	}
+	for _, size := range []int{256, 384, 512} {
+		secret := []byte(strings.Repeat(fmt.Sprintf("jwttest-hs%d-", size), size/8)[:size/8])
+		add(fmt.Sprintf("HS%d", size), secret, secret)
+		add(fmt.Sprintf("RS%d", size), rsaKey, &rsaKey.PublicKey)
+		add(fmt.Sprintf("PS%d", size), rsaKey, &rsaKey.PublicKey)
+	}
+	add("ES256", p256, &p256.PublicKey)
+	add("ES384", p384, &p384.PublicKey)
+	add("ES512", p521, &p521.PublicKey)
+	add("EdDSA", edKey, edKey.Public())
+}
+
+func mustLoadKey(name string) interface{} {
+	data, err := keyFiles.ReadFile("keys/" + name)
+	if err != nil {
+		panic(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		panic("jwttest: invalid test key file " + name)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
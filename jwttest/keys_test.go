@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package jwttest_test
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	for _, alg := range jwttest.Algorithms {
+		t.Run(alg, func(t *testing.T) {
+			key := jwttest.Key(alg)
+			assert.Equal(t, alg, key.Algorithm)
+			assert.Equal(t, key, jwttest.Key(alg))
+
+			token := jwttest.NewToken(alg).MustSign(t)
+			parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+				return key.PublicKey, nil
+			}, jwt.WithValidMethods([]string{alg}))
+			assert.NoError(t, err)
+			assert.Equal(t, key.KeyID, parsed.Header["kid"])
+		})
+	}
+}
+
+func TestKey_unknownAlgorithm(t *testing.T) {
+	assert.PanicsWithValue(t, "jwttest: no test key for signing algorithm none", func() {
+		jwttest.Key("none")
+	})
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	keys := jwttest.AsymmetricKeys()
+	assert.Len(t, keys, 10)
+	for _, k := range keys {
+		assert.False(t, k.IsSymmetric())
+		assert.NotNil(t, k.JWK())
+	}
+	assert.Nil(t, jwttest.Key("HS256").JWK())
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package jwttest
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultIssuer is `iss` claim of tokens created with NewToken.
+	DefaultIssuer = "https://issuer.example.com"
+	// DefaultSubject is `sub` claim of tokens created with NewToken.
+	DefaultSubject = "test-subject"
+	// DefaultAudience is `aud` claim of tokens created with NewToken.
+	DefaultAudience = "https://api.example.com"
+	// WrongAudience is `aud` claim set by TokenBuilder.WrongAudience.
+	WrongAudience = "https://wrong.example.com"
+	// WrongKeyID is `kid` header set by TokenBuilder.WrongKeyID.
+	WrongKeyID = "test-unknown-kid"
+)
+
+// TokenBuilder builds signed test tokens. Builder methods modify and return the same builder so calls can be chained:
+//
+//	token := jwttest.NewToken("RS256").Subject("alice").Claim("roles", []string{"admin"}).MustSign(t)
+type TokenBuilder struct {
+	key      KeyPair
+	signWith *KeyPair
+	header   map[string]interface{}
+	claims   jwt.MapClaims
+	now      time.Time
+	ttl      time.Duration
+	nbf      *time.Duration
+	tamper   bool
+}
+
+// NewToken creates builder for token signed with test key of the algorithm. Token has `iss`, `sub`, `aud`, `iat`
+// and `exp` (1 hour from now) claims and `typ` and `kid` headers.
+func NewToken(alg string) *TokenBuilder {
+	return NewTokenWithKey(Key(alg))
+}
+
+// NewTokenWithKey creates builder for token signed with given key pair. See NewToken.
+func NewTokenWithKey(key KeyPair) *TokenBuilder {
+	return &TokenBuilder{
+		key:    key,
+		header: map[string]interface{}{"typ": "JWT", "kid": key.KeyID},
+		claims: jwt.MapClaims{
+			"iss": DefaultIssuer,
+			"sub": DefaultSubject,
+			"aud": DefaultAudience,
+		},
+		ttl: time.Hour,
+	}
+}
+
+// At sets time token is issued at. `iat` and `exp` claims are relative to it.
+// Default time.Now at signing.
+func (b *TokenBuilder) At(now time.Time) *TokenBuilder {
+	b.now = now
+	return b
+}
+
+// ExpiresIn sets token lifetime.
+func (b *TokenBuilder) ExpiresIn(ttl time.Duration) *TokenBuilder {
+	b.ttl = ttl
+	return b
+}
+
+// Expired makes token expired 1 hour ago.
+func (b *TokenBuilder) Expired() *TokenBuilder {
+	return b.ExpiresIn(-time.Hour)
+}
+
+// NotYetValid sets `nbf` claim 1 hour in the future.
+func (b *TokenBuilder) NotYetValid() *TokenBuilder {
+	nbf := time.Hour
+	b.nbf = &nbf
+	return b
+}
+
+// Issuer sets `iss` claim.
+func (b *TokenBuilder) Issuer(iss string) *TokenBuilder {
+	b.claims["iss"] = iss
+	return b
+}
+
+// Subject sets `sub` claim.
+func (b *TokenBuilder) Subject(sub string) *TokenBuilder {
+	b.claims["sub"] = sub
+	return b
+}
+
+// Audience sets `aud` claim. Single value is set as string, multiple as array.
+func (b *TokenBuilder) Audience(aud ...string) *TokenBuilder {
+	if len(aud) == 1 {
+		b.claims["aud"] = aud[0]
+	} else {
+		b.claims["aud"] = aud
+	}
+	return b
+}
+
+// WrongAudience sets `aud` claim to WrongAudience.
+func (b *TokenBuilder) WrongAudience() *TokenBuilder {
+	return b.Audience(WrongAudience)
+}
+
+// Claim sets claim value. nil value removes the claim.
+func (b *TokenBuilder) Claim(name string, value interface{}) *TokenBuilder {
+	if value == nil {
+		delete(b.claims, name)
+		return b
+	}
+	b.claims[name] = value
+	return b
+}
+
+// Header sets token header value. nil value removes the header. `alg` header can not be changed.
+func (b *TokenBuilder) Header(name string, value interface{}) *TokenBuilder {
+	if value == nil {
+		delete(b.header, name)
+		return b
+	}
+	b.header[name] = value
+	return b
+}
+
+// KeyID sets `kid` header.
+func (b *TokenBuilder) KeyID(kid string) *TokenBuilder {
+	return b.Header("kid", kid)
+}
+
+// WrongKeyID sets `kid` header to WrongKeyID.
+func (b *TokenBuilder) WrongKeyID() *TokenBuilder {
+	return b.KeyID(WrongKeyID)
+}
+
+// SignWith signs token with other key pair while keeping algorithm and `kid` header of the builder key. Use it to
+// create tokens signed with wrong key. Key type must match the algorithm.
+func (b *TokenBuilder) SignWith(key KeyPair) *TokenBuilder {
+	b.signWith = &key
+	return b
+}
+
+// TamperedSignature corrupts signature of the signed token.
+func (b *TokenBuilder) TamperedSignature() *TokenBuilder {
+	b.tamper = true
+	return b
+}
+
+// claimsAt returns claims token would be signed with at given time.
+func (b *TokenBuilder) claimsAt(now time.Time) jwt.MapClaims {
+	claims := make(jwt.MapClaims, len(b.claims)+2)
+	for k, v := range b.claims {
+		claims[k] = v
+	}
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now.Unix()
+	}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = now.Add(b.ttl).Unix()
+	}
+	if b.nbf != nil {
+		claims["nbf"] = now.Add(*b.nbf).Unix()
+	}
+	return claims
+}
+
+// Sign creates signed token.
+func (b *TokenBuilder) Sign() (string, error) {
+	now := b.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(b.key.Algorithm), b.claimsAt(now))
+	token.Header = make(map[string]interface{}, len(b.header)+1)
+	for k, v := range b.header {
+		token.Header[k] = v
+	}
+	token.Header["alg"] = b.key.Algorithm
+	key := b.key.PrivateKey
+	if b.signWith != nil {
+		key = b.signWith.PrivateKey
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", err
+	}
+	if b.tamper {
+		signed = tamperSignature(signed)
+	}
+	return signed, nil
+}
+
+// MustSign creates signed token and fails the test on error.
+func (b *TokenBuilder) MustSign(t testing.TB) string {
+	t.Helper()
+	signed, err := b.Sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// tamperSignature flips bits of the first signature byte. Changing last base64 character is not enough as it may
+// only change unused padding bits.
+func tamperSignature(token string) string {
+	i := strings.LastIndex(token, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || len(sig) == 0 {
+		return token + "x"
+	}
+	sig[0] ^= 0xff
+	return token[:i+1] + base64.RawURLEncoding.EncodeToString(sig)
+}
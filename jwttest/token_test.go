@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package jwttest_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v5"
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBuilder(t *testing.T) {
+	key := jwttest.Key("ES256")
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name       string
+		whenToken  *jwttest.TokenBuilder
+		expectKind echojwt.ErrorKind
+	}{
+		{
+			name:      "ok",
+			whenToken: jwttest.NewToken("ES256"),
+		},
+		{
+			name:      "ok, custom claims",
+			whenToken: jwttest.NewToken("ES256").Subject("alice").Audience(jwttest.DefaultAudience, "other").Claim("roles", []string{"admin"}),
+		},
+		{
+			name:       "nok, expired",
+			whenToken:  jwttest.NewToken("ES256").Expired(),
+			expectKind: echojwt.ErrorKindExpired,
+		},
+		{
+			name:       "nok, not yet valid",
+			whenToken:  jwttest.NewToken("ES256").NotYetValid(),
+			expectKind: echojwt.ErrorKindNotYetValid,
+		},
+		{
+			name:       "nok, wrong audience",
+			whenToken:  jwttest.NewToken("ES256").WrongAudience(),
+			expectKind: echojwt.ErrorKindAudienceMismatch,
+		},
+		{
+			name:       "nok, wrong kid",
+			whenToken:  jwttest.NewToken("ES256").WrongKeyID(),
+			expectKind: echojwt.ErrorKindUnknownKeyID,
+		},
+		{
+			name:       "nok, tampered signature",
+			whenToken:  jwttest.NewToken("ES256").TamperedSignature(),
+			expectKind: echojwt.ErrorKindBadSignature,
+		},
+		{
+			name:       "nok, signed with other key",
+			whenToken:  jwttest.NewToken("ES256").SignWith(jwttest.KeyPair{PrivateKey: otherKey}),
+			expectKind: echojwt.ErrorKindBadSignature,
+		},
+		{
+			name:       "nok, other algorithm",
+			whenToken:  jwttest.NewToken("ES384").KeyID(key.KeyID),
+			expectKind: echojwt.ErrorKindAlgorithmNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var kind echojwt.ErrorKind
+			mw, err := echojwt.Config{
+				Issuers: []echojwt.IssuerProfile{{
+					Issuer:         jwttest.DefaultIssuer,
+					SigningKeys:    map[string]interface{}{key.KeyID: key.PublicKey},
+					SigningMethods: []string{"ES256"},
+					Audience:       []string{jwttest.DefaultAudience},
+				}},
+				ErrorHandler: func(c *echo.Context, err error) error {
+					kind = echojwt.ErrorKindOf(err)
+					return err
+				},
+			}.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.whenToken.MustSign(t))
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			err = mw(func(c *echo.Context) error { return nil })(c)
+			if tc.expectKind != "" {
+				assert.Error(t, err)
+				assert.Equal(t, tc.expectKind, kind)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTokenBuilder_At(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	token := jwttest.NewToken("HS256").At(now).ExpiresIn(time.Minute).NotYetValid().Header("typ", nil).MustSign(t)
+
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	assert.NoError(t, err)
+	assert.Equal(t, jwt.MapClaims{
+		"iss": jwttest.DefaultIssuer,
+		"sub": jwttest.DefaultSubject,
+		"aud": jwttest.DefaultAudience,
+		"iat": float64(now.Unix()),
+		"exp": float64(now.Add(time.Minute).Unix()),
+		"nbf": float64(now.Add(time.Hour).Unix()),
+	}, claims)
+	assert.Equal(t, map[string]interface{}{"alg": "HS256", "kid": "test-hs256"}, parsed.Header)
+}
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// FileKeyProviderConfig defines the config for FileKeyProvider.
+type FileKeyProviderConfig struct {
+	// Path is path to the file containing token verification keys. File can contain PEM or DER encoded public key or
+	// certificate, single JSON Web Key or JSON Web Key Set.
+	// Required.
+	Path string
+
+	// PollInterval is interval how often file is checked for changes by Watch.
+	// Optional. Default value 10 seconds.
+	PollInterval time.Duration
+
+	// ErrorHandler is called when changed file could not be read or parsed. Provider keeps serving the last good keys.
+	// Optional.
+	ErrorHandler func(err error)
+}
+
+// FileKeyProvider provides token verification keys loaded from a file and reloads them when the file changes. This is
+// useful when keys are mounted as files (i.e. Kubernetes secrets or config maps) and are rotated without restart.
+//
+// Keys are swapped atomically, requests being validated at the time of reload use either old or new keys. When the
+// changed file can not be parsed the last good keys are kept.
+//
+// Use KeyFunc method as Config.KeyFunc and run Watch in a separate goroutine.
+type FileKeyProvider struct {
+	config FileKeyProviderConfig
+
+	keys atomic.Pointer[fileKeys]
+
+	mu      sync.Mutex // guards reloading
+	modTime time.Time
+	size    int64
+}
+
+// fileKeys is immutable snapshot of keys loaded from the file or JWKS URL
+type fileKeys struct {
+	key  interface{}           // single key from PEM, DER or JWK file
+	alg  string                // `alg` of single JWK
+	keys map[string]JSONWebKey // keys from JWKS file by kid
+}
+
+// NewFileKeyProvider creates FileKeyProvider and loads keys from the file. Returns an error when file can not be read or
+// parsed.
+func NewFileKeyProvider(config FileKeyProviderConfig) (*FileKeyProvider, error) {
+	if config.Path == "" {
+		return nil, errors.New("jwt file key provider requires path")
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 10 * time.Second
+	}
+	p := &FileKeyProvider{config: config}
+	if _, err := p.reload(true); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Watch checks the file for changes every PollInterval and reloads keys when file has changed. Watch blocks until
+// context is cancelled.
+func (p *FileKeyProvider) Watch(ctx context.Context) {
+	ticker := time.NewTicker(p.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.reload(false); err != nil && p.config.ErrorHandler != nil {
+				p.config.ErrorHandler(err)
+			}
+		}
+	}
+}
+
+// Reload reloads keys from the file if the file has changed since the last load. Returns true when keys were replaced.
+// On error the last good keys are kept.
+func (p *FileKeyProvider) Reload() (bool, error) {
+	return p.reload(false)
+}
+
+func (p *FileKeyProvider) reload(force bool) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stat, err := os.Stat(p.config.Path)
+	if err != nil {
+		return false, err
+	}
+	if !force && stat.ModTime().Equal(p.modTime) && stat.Size() == p.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(p.config.Path)
+	if err != nil {
+		return false, err
+	}
+	keys, err := parseKeyFile(data)
+	if err != nil {
+		return false, fmt.Errorf("jwt file key provider failed to parse %v: %w", p.config.Path, err)
+	}
+	p.keys.Store(keys)
+	p.modTime = stat.ModTime()
+	p.size = stat.Size()
+	return true, nil
+}
+
+// KeyFunc returns verification key for the token from currently loaded keys. For key sets the key is selected by
+// token `kid` header. Token signing algorithm must match key type and JWK `alg` parameter when present. Tokens with
+// `crit` header are rejected.
+//
+// error returns TokenError.
+func (p *FileKeyProvider) KeyFunc(token *jwt.Token) (interface{}, error) {
+	return p.keys.Load().keyFunc(token)
+}
+
+// keyFunc selects key for the token and checks that the token can be verified with it.
+//
+// error returns TokenError.
+func (k *fileKeys) keyFunc(token *jwt.Token) (interface{}, error) {
+	if err := checkCriticalHeader(token); err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	key, alg := k.key, k.alg
+	if k.keys != nil {
+		kid, _ := token.Header["kid"].(string)
+		jwk, ok := k.keys[kid]
+		if !ok {
+			return nil, &TokenError{Token: token, Err: errUnexpectedKeyID(token)}
+		}
+		key, alg = jwk.Key, jwk.Algorithm
+	}
+	if err := checkKeyAlgorithm(token, key, alg); err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	return key, nil
+}
+
+// hasKeyID checks if key set contains key for the token `kid` header.
+func (k *fileKeys) hasKeyID(token *jwt.Token) bool {
+	if k.keys == nil {
+		return true
+	}
+	kid, _ := token.Header["kid"].(string)
+	_, ok := k.keys[kid]
+	return ok
+}
+
+// checkKeyAlgorithm checks that token signing method can be used with the key. keyAlg is algorithm the key is
+// restricted to, empty value means no restriction.
+func checkKeyAlgorithm(token *jwt.Token, key interface{}, keyAlg string) error {
+	alg := token.Method.Alg()
+	if token.Method == jwt.SigningMethodNone || (keyAlg != "" && keyAlg != alg) {
+		return errUnexpectedSigningMethod(token)
+	}
+	if err := validateSigningKey(alg, key); err != nil {
+		return errUnexpectedSigningMethod(token)
+	}
+	return nil
+}
+
+// parseKeyFile parses key file contents. JSON object with `keys` member is parsed as JWKS, any other JSON as single JWK
+// and everything else as PEM or DER encoded key.
+func parseKeyFile(data []byte) (*fileKeys, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var probe struct {
+			Keys json.RawMessage `json:"keys"`
+		}
+		if err := json.Unmarshal(trimmed, &probe); err != nil {
+			return nil, err
+		}
+		if probe.Keys != nil {
+			jwks, err := ParseJWKS(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			return newJWKSKeys(jwks), nil
+		}
+		jwk, err := ParseJWK(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		return &fileKeys{key: jwk.Key, alg: jwk.Algorithm}, nil
+	}
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return &fileKeys{key: key}, nil
+}
+
+// newJWKSKeys creates key snapshot from signature keys of the set.
+func newJWKSKeys(jwks JSONWebKeySet) *fileKeys {
+	keys := make(map[string]JSONWebKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		keys[k.KeyID] = k
+	}
+	return &fileKeys{keys: keys}
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileKeyProvider_Reload(t *testing.T) {
+	firstKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&firstKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys")
+	writeKeyFile(t, path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), time.Now().Add(-time.Hour))
+
+	provider, err := NewFileKeyProvider(FileKeyProviderConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := Config{KeyFunc: provider.KeyFunc}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstToken := createToken(t, jwt.SigningMethodES256, firstKey, jwt.MapClaims{"sub": "1"}, nil)
+	secondToken := createToken(t, jwt.SigningMethodES256, secondKey, jwt.MapClaims{"sub": "2"}, map[string]interface{}{"kid": "k2"})
+	assert.NoError(t, serveWithToken(mw, firstToken))
+	assert.EqualError(t, serveWithToken(mw, secondToken), "code=401, message=invalid or expired jwt, err=token signature is invalid: crypto/ecdsa: verification error")
+
+	changed, err := provider.Reload()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// rotate to JWKS file containing second key
+	secondBytes, err := secondKey.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k2","alg":"ES256","crv":"P-256","x":"%s","y":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(secondBytes[1:33]), base64.RawURLEncoding.EncodeToString(secondBytes[33:]))
+	writeKeyFile(t, path, []byte(jwks), time.Now().Add(-time.Minute))
+
+	changed, err = provider.Reload()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NoError(t, serveWithToken(mw, secondToken))
+	assert.EqualError(t, serveWithToken(mw, firstToken), "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt key id=<nil>")
+
+	// broken file keeps last good keys
+	writeKeyFile(t, path, []byte(`{"keys":[{"kty":"EC"}]}`), time.Now())
+	changed, err = provider.Reload()
+	assert.ErrorContains(t, err, "jwt file key provider failed to parse")
+	assert.False(t, changed)
+	assert.NoError(t, serveWithToken(mw, secondToken))
+}
+
+func TestFileKeyProvider_KeyFunc_algorithm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.jwk")
+	writeKeyFile(t, path, []byte(`{"kty":"oct","alg":"HS384","k":"c2VjcmV0"}`), time.Now())
+
+	provider, err := NewFileKeyProvider(FileKeyProviderConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := Config{KeyFunc: provider.KeyFunc}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, serveWithToken(mw, createToken(t, jwt.SigningMethodHS384, []byte("secret"), jwt.MapClaims{}, nil)))
+	assert.EqualError(t,
+		serveWithToken(mw, createToken(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{}, nil)),
+		"code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt signing method=HS256",
+	)
+}
+
+func TestFileKeyProvider_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.jwk")
+	writeKeyFile(t, path, []byte(`{"kty":"oct","k":"Zmlyc3Q"}`), time.Now().Add(-time.Hour))
+
+	errs := make(chan error, 10)
+	provider, err := NewFileKeyProvider(FileKeyProviderConfig{
+		Path:         path,
+		PollInterval: 10 * time.Millisecond,
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go provider.Watch(ctx)
+
+	writeKeyFile(t, path, []byte(`not a key`), time.Now())
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "jwt file key provider failed to parse")
+	case <-time.After(2 * time.Second):
+		t.Fatal("ErrorHandler was not called")
+	}
+
+	writeKeyFile(t, path, []byte(`{"kty":"oct","k":"c2Vjb25k"}`), time.Now().Add(time.Minute))
+	token := &jwt.Token{Method: jwt.SigningMethodHS256, Header: map[string]interface{}{"alg": "HS256"}}
+	assert.Eventually(t, func() bool {
+		key, err := provider.KeyFunc(token)
+		return err == nil && string(key.([]byte)) == "second"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestNewFileKeyProvider_error(t *testing.T) {
+	_, err := NewFileKeyProvider(FileKeyProviderConfig{})
+	assert.EqualError(t, err, "jwt file key provider requires path")
+
+	_, err = NewFileKeyProvider(FileKeyProviderConfig{Path: filepath.Join(t.TempDir(), "missing")})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func writeKeyFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serveWithToken(mw echo.MiddlewareFunc, token string) error {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	return mw(func(c *echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})(c)
+}
@@ -0,0 +1,369 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JSONWebKey is parsed JSON Web Key (RFC 7517).
+type JSONWebKey struct {
+	// KeyID is `kid` parameter of the key.
+	KeyID string
+	// Algorithm is `alg` parameter of the key.
+	Algorithm string
+	// Use is `use` parameter of the key. `sig` for signature keys and `enc` for encryption keys.
+	Use string
+	// Key is the parsed key. *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey or []byte for symmetric keys.
+	Key interface{}
+	// Certificates is parsed `x5c` certificate chain of the key, leaf certificate first.
+	Certificates []*x509.Certificate
+}
+
+// JSONWebKeySet is parsed JSON Web Key Set (RFC 7517).
+type JSONWebKeySet struct {
+	Keys []JSONWebKey
+}
+
+// jsonWebKey is JSON representation of JSONWebKey
+type jsonWebKey struct {
+	Kty string   `json:"kty"`
+	Kid string   `json:"kid,omitempty"`
+	Alg string   `json:"alg,omitempty"`
+	Use string   `json:"use,omitempty"`
+	N   string   `json:"n,omitempty"`
+	E   string   `json:"e,omitempty"`
+	Crv string   `json:"crv,omitempty"`
+	X   string   `json:"x,omitempty"`
+	Y   string   `json:"y,omitempty"`
+	K   string   `json:"k,omitempty"`
+	X5c []string `json:"x5c,omitempty"`
+}
+
+// ParsePublicKeyPEM parses PEM encoded public key. Supported PEM block types are `PUBLIC KEY` (PKIX),
+// `RSA PUBLIC KEY` (PKCS #1) and `CERTIFICATE`. For certificates the certificate public key is returned.
+// The first supported block in data is used.
+func ParsePublicKeyPEM(data []byte) (interface{}, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("jwt key: no public key or certificate found in PEM data")
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			return x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			return x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			return cert.PublicKey, nil
+		}
+	}
+}
+
+// ParsePublicKeyDER parses DER encoded PKIX or PKCS #1 public key or certificate. For certificates the certificate
+// public key is returned.
+func ParsePublicKeyDER(data []byte) (interface{}, error) {
+	if key, err := x509.ParsePKIXPublicKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(data); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, errors.New("jwt key: data is not DER encoded public key or certificate")
+}
+
+// ParsePrivateKeyPEM parses PEM encoded private key to be used for signing tokens. Supported PEM block types are
+// `PRIVATE KEY` (PKCS #8), `RSA PRIVATE KEY` (PKCS #1) and `EC PRIVATE KEY` (SEC 1).
+func ParsePrivateKeyPEM(data []byte) (interface{}, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("jwt key: no private key found in PEM data")
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			return x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+	}
+}
+
+// ParseJWK parses JSON Web Key. Only public and symmetric key parameters are read, private key parameters are ignored.
+func ParseJWK(data []byte) (JSONWebKey, error) {
+	var raw jsonWebKey
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return JSONWebKey{}, fmt.Errorf("jwt key: invalid JWK JSON: %w", err)
+	}
+	return raw.toJSONWebKey()
+}
+
+// ParseJWKS parses JSON Web Key Set. Any invalid key in the set results in error.
+func ParseJWKS(data []byte) (JSONWebKeySet, error) {
+	var raw struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return JSONWebKeySet{}, fmt.Errorf("jwt key: invalid JWKS JSON: %w", err)
+	}
+	if raw.Keys == nil {
+		return JSONWebKeySet{}, errors.New("jwt key: JWKS is missing keys member")
+	}
+	result := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(raw.Keys))}
+	for i, rawKey := range raw.Keys {
+		key, err := ParseJWK(rawKey)
+		if err != nil {
+			return JSONWebKeySet{}, fmt.Errorf("jwt key: invalid JWKS key at index %d: %w", i, err)
+		}
+		result.Keys = append(result.Keys, key)
+	}
+	return result, nil
+}
+
+// SigningKeys returns signature keys of the set as map suitable for Config.SigningKeys. Keys without `kid` and keys
+// with `use` other than `sig` are skipped.
+func (s JSONWebKeySet) SigningKeys() map[string]interface{} {
+	result := make(map[string]interface{}, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.KeyID == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		result[k.KeyID] = k.Key
+	}
+	return result
+}
+
+// LoadPublicKeyFile loads public key from file. File can contain PEM encoded public key or certificate, DER encoded
+// public key or certificate or single JSON Web Key.
+func LoadPublicKeyFile(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePublicKey(data)
+}
+
+// LoadPrivateKeyFile loads PEM encoded private key from file.
+func LoadPrivateKeyFile(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+// LoadJWKSFile loads JSON Web Key Set from file.
+func LoadJWKSFile(path string) (JSONWebKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+	return ParseJWKS(data)
+}
+
+// parsePublicKey detects data format (PEM, JWK or DER) and parses public key from it.
+func parsePublicKey(data []byte) (interface{}, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		return ParsePublicKeyPEM(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		jwk, err := ParseJWK(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		return jwk.Key, nil
+	}
+	return ParsePublicKeyDER(data)
+}
+
+func (raw jsonWebKey) toJSONWebKey() (JSONWebKey, error) {
+	result := JSONWebKey{KeyID: raw.Kid, Algorithm: raw.Alg, Use: raw.Use}
+	for i, c := range raw.X5c {
+		der, err := base64.StdEncoding.DecodeString(c)
+		if err != nil {
+			return JSONWebKey{}, fmt.Errorf("jwt key: invalid JWK x5c certificate at index %d: %w", i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return JSONWebKey{}, fmt.Errorf("jwt key: invalid JWK x5c certificate at index %d: %w", i, err)
+		}
+		result.Certificates = append(result.Certificates, cert)
+	}
+
+	var err error
+	switch raw.Kty {
+	case "RSA":
+		result.Key, err = raw.rsaKey()
+	case "EC":
+		result.Key, err = raw.ecKey()
+	case "OKP":
+		result.Key, err = raw.okpKey()
+	case "oct":
+		result.Key, err = decodeJWKParam("k", raw.K)
+	default:
+		err = fmt.Errorf("jwt key: unsupported JWK key type: %q", raw.Kty)
+	}
+	if err != nil {
+		return JSONWebKey{}, err
+	}
+
+	if len(result.Certificates) > 0 {
+		type equaler interface {
+			Equal(x crypto.PublicKey) bool
+		}
+		k, ok := result.Certificates[0].PublicKey.(equaler)
+		if !ok || !k.Equal(result.Key) {
+			return JSONWebKey{}, errors.New("jwt key: JWK x5c certificate does not match key parameters")
+		}
+	}
+	return result, nil
+}
+
+func (raw jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeJWKParam("n", raw.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeJWKParam("e", raw.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("jwt key: invalid JWK RSA exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func (raw jsonWebKey) ecKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch raw.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("jwt key: unsupported JWK EC curve: %q", raw.Crv)
+	}
+	x, err := decodeJWKParam("x", raw.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeJWKParam("y", raw.Y)
+	if err != nil {
+		return nil, err
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x) > size || len(y) > size {
+		return nil, errors.New("jwt key: invalid JWK EC coordinate length")
+	}
+	point := make([]byte, 1+2*size)
+	point[0] = 4 // uncompressed point
+	copy(point[1+size-len(x):1+size], x)
+	copy(point[1+2*size-len(y):], y)
+	key, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+	if err != nil {
+		return nil, fmt.Errorf("jwt key: invalid JWK EC point: %w", err)
+	}
+	return key, nil
+}
+
+func (raw jsonWebKey) okpKey() (ed25519.PublicKey, error) {
+	if raw.Crv != "Ed25519" {
+		return nil, fmt.Errorf("jwt key: unsupported JWK OKP curve: %q", raw.Crv)
+	}
+	x, err := decodeJWKParam("x", raw.X)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, errors.New("jwt key: invalid JWK Ed25519 key length")
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+func decodeJWKParam(name string, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("jwt key: JWK is missing %q parameter", name)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("jwt key: invalid JWK %q parameter: %w", name, err)
+	}
+	return b, nil
+}
+
+// validateSigningKey checks that Go type of the key can be used to verify tokens signed with given method. Signing
+// methods not known to this library are not checked.
+func validateSigningKey(method string, key interface{}) error {
+	switch m := jwt.GetSigningMethod(method).(type) {
+	case *jwt.SigningMethodHMAC:
+		k, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("jwt signing key type %T does not match signing method %v, expected []byte", key, method)
+		}
+		if len(k) == 0 {
+			return fmt.Errorf("jwt signing key for signing method %v is empty", method)
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := key.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("jwt signing key type %T does not match signing method %v, expected *rsa.PublicKey", key, method)
+		}
+	case *jwt.SigningMethodECDSA:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt signing key type %T does not match signing method %v, expected *ecdsa.PublicKey", key, method)
+		}
+		if k.Curve == nil || k.Curve.Params().BitSize != m.CurveBits {
+			return fmt.Errorf("jwt signing key curve does not match signing method %v", method)
+		}
+	case *jwt.SigningMethodEd25519:
+		if _, ok := key.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("jwt signing key type %T does not match signing method %v, expected ed25519.PublicKey", key, method)
+		}
+	}
+	return nil
+}
+
+// validateSigningKeyAny checks that Go type of the key can be used to verify tokens signed with at least one of given
+// methods.
+func validateSigningKeyAny(methods []string, key interface{}) error {
+	var err error
+	for _, method := range methods {
+		if err = validateSigningKey(method, key); err == nil {
+			return nil
+		}
+	}
+	return err
+}
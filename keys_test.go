@@ -0,0 +1,332 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := createCertificate(t, &rsaKey.PublicKey, rsaKey)
+
+	var testCases = []struct {
+		name        string
+		when        []byte
+		expectError string
+	}{
+		{
+			name: "ok, PKIX public key",
+			when: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}),
+		},
+		{
+			name: "ok, PKCS1 public key",
+			when: pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}),
+		},
+		{
+			name: "ok, certificate",
+			when: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		},
+		{
+			name: "ok, first supported block is used",
+			when: append(
+				pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+				pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix})...,
+			),
+		},
+		{
+			name:        "nok, no public key",
+			when:        pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			expectError: "jwt key: no public key or certificate found in PEM data",
+		},
+		{
+			name:        "nok, not PEM",
+			when:        []byte("secret"),
+			expectError: "jwt key: no public key or certificate found in PEM data",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := ParsePublicKeyPEM(tc.when)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, rsaKey.PublicKey.Equal(key))
+		})
+	}
+}
+
+func TestParsePublicKeyDER(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePublicKeyDER(pkix)
+	assert.NoError(t, err)
+	assert.True(t, ecKey.PublicKey.Equal(key))
+
+	key, err = ParsePublicKeyDER(createCertificate(t, &ecKey.PublicKey, ecKey).Raw)
+	assert.NoError(t, err)
+	assert.True(t, ecKey.PublicKey.Equal(key))
+
+	_, err = ParsePublicKeyDER([]byte("nope"))
+	assert.EqualError(t, err, "jwt key: data is not DER encoded public key or certificate")
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.True(t, ecKey.Equal(key))
+
+	_, err = ParsePrivateKeyPEM([]byte("nope"))
+	assert.EqualError(t, err, "jwt key: no private key found in PEM data")
+}
+
+func TestParseJWK(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	ecBytes, err := ecKey.PublicKey.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert := createCertificate(t, &otherKey.PublicKey, otherKey)
+
+	var testCases = []struct {
+		name        string
+		when        string
+		expectKey   interface{}
+		expectKID   string
+		expectError string
+	}{
+		{
+			name: "ok, RSA",
+			when: fmt.Sprintf(`{"kty":"RSA","kid":"r1","alg":"RS256","use":"sig","n":"%s","e":"AQAB"}`,
+				b64(rsaKey.N.Bytes())),
+			expectKey: &rsaKey.PublicKey,
+			expectKID: "r1",
+		},
+		{
+			name: "ok, EC",
+			when: fmt.Sprintf(`{"kty":"EC","kid":"e1","crv":"P-384","x":"%s","y":"%s"}`,
+				b64(ecBytes[1:49]), b64(ecBytes[49:])),
+			expectKey: &ecKey.PublicKey,
+			expectKID: "e1",
+		},
+		{
+			name:      "ok, OKP",
+			when:      fmt.Sprintf(`{"kty":"OKP","crv":"Ed25519","x":"%s"}`, b64(edKey)),
+			expectKey: edKey,
+		},
+		{
+			name:      "ok, oct",
+			when:      `{"kty":"oct","k":"c2VjcmV0"}`,
+			expectKey: []byte("secret"),
+		},
+		{
+			name:        "nok, unsupported key type",
+			when:        `{"kty":"XYZ"}`,
+			expectError: `jwt key: unsupported JWK key type: "XYZ"`,
+		},
+		{
+			name:        "nok, missing RSA modulus",
+			when:        `{"kty":"RSA","e":"AQAB"}`,
+			expectError: `jwt key: JWK is missing "n" parameter`,
+		},
+		{
+			name:        "nok, EC point not on curve",
+			when:        `{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}`,
+			expectError: `jwt key: invalid JWK EC point: `, // rest of the message comes from standard library
+		},
+		{
+			name: "nok, x5c does not match key",
+			when: fmt.Sprintf(`{"kty":"RSA","n":"%s","e":"AQAB","x5c":["%s"]}`,
+				b64(rsaKey.N.Bytes()), base64.StdEncoding.EncodeToString(otherCert.Raw)),
+			expectError: `jwt key: JWK x5c certificate does not match key parameters`,
+		},
+		{
+			name:        "nok, invalid JSON",
+			when:        `{`,
+			expectError: `jwt key: invalid JWK JSON: unexpected end of JSON input`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jwk, err := ParseJWK([]byte(tc.when))
+			if tc.expectError != "" {
+				assert.ErrorContains(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectKey, jwk.Key)
+			assert.Equal(t, tc.expectKID, jwk.KeyID)
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	jwks, err := ParseJWKS([]byte(`{"keys":[
+		{"kty":"oct","kid":"a","k":"YQ"},
+		{"kty":"oct","kid":"b","use":"enc","k":"Yg"},
+		{"kty":"oct","k":"Yw"}
+	]}`))
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Keys, 3)
+	assert.Equal(t, map[string]interface{}{"a": []byte("a")}, jwks.SigningKeys())
+
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"oct"}]}`))
+	assert.EqualError(t, err, `jwt key: invalid JWKS key at index 0: jwt key: JWK is missing "k" parameter`)
+
+	_, err = ParseJWKS([]byte(`{}`))
+	assert.EqualError(t, err, `jwt key: JWKS is missing keys member`)
+}
+
+func TestLoadPublicKeyFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"key.pem": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		"key.der": der,
+		"key.jwk": []byte(fmt.Sprintf(`{"kty":"RSA","n":"%s","e":"AQAB"}`,
+			base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()))),
+	}
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			key, err := LoadPublicKeyFile(path)
+			assert.NoError(t, err)
+			assert.True(t, rsaKey.PublicKey.Equal(key))
+		})
+	}
+
+	_, err = LoadPublicKeyFile(filepath.Join(dir, "missing.pem"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidateSigningKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		whenMethod  string
+		whenKey     interface{}
+		expectError string
+	}{
+		{whenMethod: "HS256", whenKey: []byte("secret")},
+		{whenMethod: "HS256", whenKey: "secret", expectError: "jwt signing key type string does not match signing method HS256, expected []byte"},
+		{whenMethod: "HS512", whenKey: []byte{}, expectError: "jwt signing key for signing method HS512 is empty"},
+		{whenMethod: "RS256", whenKey: &rsaKey.PublicKey},
+		{whenMethod: "PS384", whenKey: &rsaKey.PublicKey},
+		{whenMethod: "RS256", whenKey: rsaKey, expectError: "jwt signing key type *rsa.PrivateKey does not match signing method RS256, expected *rsa.PublicKey"},
+		{whenMethod: "ES256", whenKey: &ecKey.PublicKey},
+		{whenMethod: "ES384", whenKey: &ecKey.PublicKey, expectError: "jwt signing key curve does not match signing method ES384"},
+		{whenMethod: "EdDSA", whenKey: edKey},
+		{whenMethod: "EdDSA", whenKey: &rsaKey.PublicKey, expectError: "jwt signing key type *rsa.PublicKey does not match signing method EdDSA, expected ed25519.PublicKey"},
+		{whenMethod: "custom", whenKey: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%v %T", tc.whenMethod, tc.whenKey), func(t *testing.T) {
+			err := validateSigningKey(tc.whenMethod, tc.whenKey)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func createCertificate(t testing.TB, pub interface{}, priv interface{}) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
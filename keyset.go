@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerificationKey is token verification key with metadata restricting how and when the key can be used.
+type VerificationKey struct {
+	// Key is the verification key. Key type must match Algorithm.
+	// Required.
+	Key interface{}
+
+	// Algorithm is the only token signing algorithm this key can be used with.
+	// Optional. Defaults to Config.SigningMethod.
+	Algorithm string
+
+	// Use is intended use of the key (`use` parameter of JWK). Keys with use other than `sig` are never used to verify
+	// tokens.
+	// Optional. Default value "sig".
+	Use string
+
+	// NotBefore is time when key becomes active. Tokens are not verified with the key before that time.
+	// Optional. Zero value means key is active immediately.
+	NotBefore time.Time
+
+	// NotAfter is time when key is retired. Tokens are not verified with the key after that time.
+	// Optional. Zero value means key is never retired.
+	NotAfter time.Time
+}
+
+// KeySet is map of token verification keys by key id (`kid` header).
+type KeySet map[string]VerificationKey
+
+// KeySet returns signature keys of the set as KeySet preserving `alg` and `use` parameters. Keys without `kid` are
+// skipped.
+func (s JSONWebKeySet) KeySet() KeySet {
+	result := make(KeySet, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.KeyID == "" {
+			continue
+		}
+		result[k.KeyID] = VerificationKey{Key: k.Key, Algorithm: k.Algorithm, Use: k.Use}
+	}
+	return result
+}
+
+// activeAt checks if the key can be used at given time.
+func (k VerificationKey) activeAt(now time.Time) bool {
+	if !k.NotBefore.IsZero() && now.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && !now.Before(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// validate checks that key type matches its algorithm.
+func (s KeySet) validate(defaultAlgorithm string) error {
+	for kid, k := range s {
+		alg := k.Algorithm
+		if alg == "" {
+			alg = defaultAlgorithm
+		}
+		if err := validateSigningKey(alg, k.Key); err != nil {
+			return fmt.Errorf("%w, key id=%v", err, kid)
+		}
+	}
+	return nil
+}
+
+// lookup selects key by token `kid` header and checks that the key can be used for the token at given time.
+//
+// error returns TokenError.
+func (s KeySet) lookup(token *jwt.Token, defaultAlgorithm string, now time.Time) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := s[kid]
+	if !ok || (k.Use != "" && k.Use != "sig") {
+		return nil, &TokenError{Token: token, Err: errUnexpectedKeyID(token)}
+	}
+	alg := k.Algorithm
+	if alg == "" {
+		alg = defaultAlgorithm
+	}
+	if token.Method.Alg() != alg {
+		return nil, &TokenError{Token: token, Err: errUnexpectedSigningMethod(token)}
+	}
+	if !k.activeAt(now) {
+		return nil, &TokenError{Token: token, Err: ErrorKindUnknownKeyID.Wrap(fmt.Errorf("jwt key is not active, key id=%v", kid))}
+	}
+	return k.Key, nil
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_KeySet(t *testing.T) {
+	ecKey := generateECKey(t)
+	now := time.Now()
+	keySet := KeySet{
+		"current": {Key: []byte("current_secret")},
+		"es":      {Key: &ecKey.PublicKey, Algorithm: "ES256"},
+		"retired": {Key: []byte("retired_secret"), NotAfter: now.Add(-time.Minute)},
+		"next":    {Key: []byte("next_secret"), NotBefore: now.Add(time.Hour)},
+		"rolling": {Key: []byte("rolling_secret"), NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)},
+		"enc":     {Key: []byte("enc_secret"), Use: "enc"},
+	}
+
+	var testCases = []struct {
+		name        string
+		whenToken   string
+		expectError string
+	}{
+		{
+			name:      "ok, key without metadata",
+			whenToken: createToken(t, jwt.SigningMethodHS256, []byte("current_secret"), jwt.MapClaims{}, map[string]interface{}{"kid": "current"}),
+		},
+		{
+			name:      "ok, key with own algorithm",
+			whenToken: createToken(t, jwt.SigningMethodES256, ecKey, jwt.MapClaims{}, map[string]interface{}{"kid": "es"}),
+		},
+		{
+			name:      "ok, key within activation window",
+			whenToken: createToken(t, jwt.SigningMethodHS256, []byte("rolling_secret"), jwt.MapClaims{}, map[string]interface{}{"kid": "rolling"}),
+		},
+		{
+			name:        "nok, algorithm does not match key algorithm",
+			whenToken:   createToken(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{}, map[string]interface{}{"kid": "es"}),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt signing method=HS256",
+		},
+		{
+			name:        "nok, retired key",
+			whenToken:   createToken(t, jwt.SigningMethodHS256, []byte("retired_secret"), jwt.MapClaims{}, map[string]interface{}{"kid": "retired"}),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: jwt key is not active, key id=retired",
+		},
+		{
+			name:        "nok, not yet active key",
+			whenToken:   createToken(t, jwt.SigningMethodHS256, []byte("next_secret"), jwt.MapClaims{}, map[string]interface{}{"kid": "next"}),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: jwt key is not active, key id=next",
+		},
+		{
+			name:        "nok, encryption key",
+			whenToken:   createToken(t, jwt.SigningMethodHS256, []byte("enc_secret"), jwt.MapClaims{}, map[string]interface{}{"kid": "enc"}),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt key id=enc",
+		},
+		{
+			name:        "nok, unknown key id",
+			whenToken:   createToken(t, jwt.SigningMethodHS256, []byte("current_secret"), jwt.MapClaims{}, nil),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt key id=<nil>",
+		},
+	}
+
+	mw, err := Config{KeySet: keySet}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := serveWithToken(mw, tc.whenToken)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_KeySet_invalidKeyType(t *testing.T) {
+	_, err := Config{KeySet: KeySet{"a": {Key: []byte("secret"), Algorithm: "ES256"}}}.ToMiddleware()
+	assert.EqualError(t, err, "jwt signing key type []uint8 does not match signing method ES256, expected *ecdsa.PublicKey, key id=a")
+}
+
+func TestJSONWebKeySet_KeySet(t *testing.T) {
+	jwks, err := ParseJWKS([]byte(`{"keys":[
+		{"kty":"oct","kid":"a","alg":"HS384","use":"sig","k":"YQ"},
+		{"kty":"oct","k":"Yw"}
+	]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, KeySet{"a": {Key: []byte("a"), Algorithm: "HS384", Use: "sig"}}, jwks.KeySet())
+}
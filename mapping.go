@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PrincipalMapping defines token claims Principal fields are read from. Each field is claim path expression: claim
+// names separated by dots for nested claims, for example "realm_access.roles". Claim names containing dots or brackets
+// are written in brackets and double quotes, for example `resource_access["my.app"].roles`. Claim with name equal to
+// the whole path takes precedence, so namespaced claims like "https://example.com/roles" can be used as is.
+//
+// Claims missing from the token or having unexpected type leave Principal fields empty, token is not rejected.
+type PrincipalMapping struct {
+	// Subject is path of the claim Principal.Subject is read from.
+	// Optional. Default value "sub".
+	Subject string
+
+	// Tenant is path of the claim Principal.Tenant is read from.
+	// Optional. When empty tenant is not mapped.
+	Tenant string
+
+	// Roles is path of the claim Principal.Roles are read from. Claim can be an array of strings or a space separated
+	// string.
+	// Optional. When empty roles are not mapped.
+	Roles string
+
+	// Scopes is path of the claim Principal.Scopes are read from. Claim can be an array of strings or a space separated
+	// string.
+	// Optional. Default value "scope".
+	Scopes string
+
+	// Email is path of the claim Principal.Email is read from.
+	// Optional. Default value "email".
+	Email string
+}
+
+// claimPath is compiled claim path expression
+type claimPath struct {
+	raw      string
+	segments []string
+}
+
+// principalMapper is compiled PrincipalMapping
+type principalMapper struct {
+	subject, tenant, roles, scopes, email *claimPath
+}
+
+func newPrincipalMapper(mapping PrincipalMapping) (*principalMapper, error) {
+	if mapping.Subject == "" {
+		mapping.Subject = "sub"
+	}
+	if mapping.Scopes == "" {
+		mapping.Scopes = "scope"
+	}
+	if mapping.Email == "" {
+		mapping.Email = "email"
+	}
+	m := &principalMapper{}
+	for _, f := range []struct {
+		name   string
+		path   string
+		target **claimPath
+	}{
+		{name: "Subject", path: mapping.Subject, target: &m.subject},
+		{name: "Tenant", path: mapping.Tenant, target: &m.tenant},
+		{name: "Roles", path: mapping.Roles, target: &m.roles},
+		{name: "Scopes", path: mapping.Scopes, target: &m.scopes},
+		{name: "Email", path: mapping.Email, target: &m.email},
+	} {
+		if f.path == "" {
+			continue
+		}
+		p, err := parseClaimPath(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("jwt middleware principal mapping %v: %w", f.name, err)
+		}
+		*f.target = p
+	}
+	return m, nil
+}
+
+// principal creates principal from token claims. Tokens of other types than *jwt.Token result in principal without
+// mapped fields.
+func (m *principalMapper) principal(token interface{}) *Principal {
+	p := &Principal{Scheme: AuthSchemeJWT}
+	t, ok := token.(*jwt.Token)
+	if !ok {
+		return p
+	}
+	claims, err := claimsToMap(t.Claims)
+	if err != nil {
+		return p
+	}
+	p.Subject = m.subject.lookupString(claims)
+	p.Tenant = m.tenant.lookupString(claims)
+	p.Roles = m.roles.lookupStrings(claims)
+	p.Scopes = m.scopes.lookupStrings(claims)
+	p.Email = m.email.lookupString(claims)
+	return p
+}
+
+// parseClaimPath parses claim path expression.
+func parseClaimPath(path string) (*claimPath, error) {
+	result := &claimPath{raw: path}
+	rest := path
+	for {
+		var segment string
+		if strings.HasPrefix(rest, `["`) {
+			end := strings.Index(rest, `"]`)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid claim path %q: missing closing bracket", path)
+			}
+			segment, rest = rest[2:end], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			segment, rest = rest[:end], rest[end:]
+		}
+		if segment == "" {
+			return nil, fmt.Errorf("invalid claim path %q: empty claim name", path)
+		}
+		result.segments = append(result.segments, segment)
+
+		switch {
+		case rest == "":
+			return result, nil
+		case rest[0] == '.':
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("invalid claim path %q: empty claim name", path)
+			}
+		case !strings.HasPrefix(rest, `["`):
+			return nil, fmt.Errorf("invalid claim path %q: unexpected character at %d", path, len(path)-len(rest))
+		}
+	}
+}
+
+// lookup returns claim value at the path. ok is false when claim does not exist.
+func (p *claimPath) lookup(claims jwt.MapClaims) (interface{}, bool) {
+	if p == nil {
+		return nil, false
+	}
+	if v, ok := claims[p.raw]; ok {
+		return v, true
+	}
+	var current interface{} = map[string]interface{}(claims)
+	for _, segment := range p.segments {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[segment]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// lookupString returns claim value at the path as string. Integral numbers are converted to string, other types
+// result in empty string.
+func (p *claimPath) lookupString(claims jwt.MapClaims) string {
+	v, _ := p.lookup(claims)
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		if value == float64(int64(value)) {
+			return strconv.FormatInt(int64(value), 10)
+		}
+	}
+	return ""
+}
+
+// lookupStrings returns claim value at the path as string slice. Claim can be an array of strings or a space separated
+// string.
+func (p *claimPath) lookupStrings(claims jwt.MapClaims) []string {
+	v, _ := p.lookup(claims)
+	if s, ok := v.(string); ok {
+		return strings.Fields(s)
+	}
+	return toStrings(v)
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClaimPath(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		whenPath    string
+		expect      []string
+		expectError string
+	}{
+		{name: "ok, single claim", whenPath: "groups", expect: []string{"groups"}},
+		{name: "ok, nested claim", whenPath: "realm_access.roles", expect: []string{"realm_access", "roles"}},
+		{
+			name:     "ok, bracket claim",
+			whenPath: `resource_access["my.app"].roles`,
+			expect:   []string{"resource_access", "my.app", "roles"},
+		},
+		{
+			name:     "ok, leading bracket claim",
+			whenPath: `["https://example.com/claims"]["tenant.id"]`,
+			expect:   []string{"https://example.com/claims", "tenant.id"},
+		},
+		{name: "nok, empty", whenPath: "", expectError: `invalid claim path "": empty claim name`},
+		{name: "nok, trailing dot", whenPath: "a.", expectError: `invalid claim path "a.": empty claim name`},
+		{name: "nok, double dot", whenPath: "a..b", expectError: `invalid claim path "a..b": empty claim name`},
+		{name: "nok, empty bracket", whenPath: `a[""]`, expectError: `invalid claim path "a[\"\"]": empty claim name`},
+		{name: "nok, unclosed bracket", whenPath: `a["b`, expectError: `invalid claim path "a[\"b": missing closing bracket`},
+		{name: "nok, unquoted bracket", whenPath: `a[b]`, expectError: `invalid claim path "a[b]": unexpected character at 1`},
+		{name: "nok, text after bracket", whenPath: `["a"]b`, expectError: `invalid claim path "[\"a\"]b": unexpected character at 5`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := parseClaimPath(tc.whenPath)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, p.segments)
+		})
+	}
+}
+
+func TestConfig_PrincipalMapping(t *testing.T) {
+	var testCases = []struct {
+		name            string
+		givenMapping    *PrincipalMapping
+		whenToken       *jwttest.TokenBuilder
+		expectPrincipal *Principal
+	}{
+		{
+			name:            "ok, without mapping only subject is set",
+			whenToken:       jwttest.NewToken("HS256").Claim("scope", "read write").Claim("email", "joe@example.com"),
+			expectPrincipal: &Principal{Scheme: AuthSchemeJWT, Subject: jwttest.DefaultSubject},
+		},
+		{
+			name:         "ok, defaults",
+			givenMapping: &PrincipalMapping{},
+			whenToken:    jwttest.NewToken("HS256").Claim("scope", "read write").Claim("email", "joe@example.com"),
+			expectPrincipal: &Principal{
+				Scheme:  AuthSchemeJWT,
+				Subject: jwttest.DefaultSubject,
+				Scopes:  []string{"read", "write"},
+				Email:   "joe@example.com",
+			},
+		},
+		{
+			name: "ok, keycloak style nested claims",
+			givenMapping: &PrincipalMapping{
+				Subject: "preferred_username",
+				Tenant:  "organization.id",
+				Roles:   `resource_access["my.app"].roles`,
+			},
+			whenToken: jwttest.NewToken("HS256").
+				Claim("preferred_username", "joe").
+				Claim("organization", map[string]interface{}{"id": 42}).
+				Claim("resource_access", map[string]interface{}{"my.app": map[string]interface{}{"roles": []string{"admin", "user"}}}),
+			expectPrincipal: &Principal{Scheme: AuthSchemeJWT, Subject: "joe", Tenant: "42", Roles: []string{"admin", "user"}},
+		},
+		{
+			name:         "ok, namespaced claims",
+			givenMapping: &PrincipalMapping{Roles: "https://example.com/roles", Tenant: "https://example.com/tenant", Scopes: "scp"},
+			whenToken: jwttest.NewToken("HS256").
+				Claim("https://example.com/roles", []string{"editor"}).
+				Claim("https://example.com/tenant", "acme").
+				Claim("scp", []string{"read"}),
+			expectPrincipal: &Principal{
+				Scheme:  AuthSchemeJWT,
+				Subject: jwttest.DefaultSubject,
+				Tenant:  "acme",
+				Roles:   []string{"editor"},
+				Scopes:  []string{"read"},
+			},
+		},
+		{
+			name:         "ok, missing and mistyped claims are left empty",
+			givenMapping: &PrincipalMapping{Roles: "groups", Tenant: "org.id"},
+			whenToken:    jwttest.NewToken("HS256").Claim("org", "acme").Claim("email", true).Claim("groups", 1),
+			expectPrincipal: &Principal{
+				Scheme:  AuthSchemeJWT,
+				Subject: jwttest.DefaultSubject,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := Config{SigningKey: jwttest.Key("HS256").PublicKey, PrincipalMapping: tc.givenMapping}.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.whenToken.MustSign(t))
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			var principal *Principal
+			var token *jwt.Token
+			err = mw(func(c *echo.Context) error {
+				principal = PrincipalFromContext(c)
+				token, _ = c.Get("user").(*jwt.Token)
+				return nil
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectPrincipal, principal)
+			assert.NotNil(t, token)
+		})
+	}
+}
+
+func TestConfig_PrincipalMapping_customClaims(t *testing.T) {
+	type customClaims struct {
+		jwt.RegisteredClaims
+		Groups []string `json:"groups"`
+	}
+	mw, err := Config{
+		SigningKey:       jwttest.Key("HS256").PublicKey,
+		NewClaimsFunc:    func(c *echo.Context) jwt.Claims { return &customClaims{} },
+		PrincipalMapping: &PrincipalMapping{Roles: "groups"},
+	}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+jwttest.NewToken("HS256").Claim("groups", []string{"a", "b"}).MustSign(t))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	err = mw(func(c *echo.Context) error {
+		assert.Equal(t, []string{"a", "b"}, PrincipalFromContext(c).Roles)
+		return nil
+	})(c)
+	assert.NoError(t, err)
+}
+
+func TestConfig_PrincipalMapping_invalid(t *testing.T) {
+	_, err := Config{SigningKey: []byte("secret"), PrincipalMapping: &PrincipalMapping{Roles: "realm_access..roles"}}.ToMiddleware()
+	assert.EqualError(t, err, `jwt middleware principal mapping Roles: invalid claim path "realm_access..roles": empty claim name`)
+}
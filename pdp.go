@@ -0,0 +1,292 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+const pdpMaxResponseSize = 1 << 20
+
+// PDPConfig defines the config for external policy decision point (PDP) authorization middleware.
+//
+// Middleware sends POST request with JSON body `{"input": PDPInput}` to the decision endpoint, similar to Open Policy
+// Agent data API. Endpoint responds with `{"result": true}` or `{"result": {"allow": true, "reason": "..."}}`.
+// Authorization middleware must be executed after JWT middleware.
+type PDPConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// ContextKey is key where JWT middleware stored the token in context. When there is no token in context input
+	// claims are empty.
+	// Optional. Default value "user".
+	ContextKey string
+
+	// URL is URL of the decision endpoint, for example "http://localhost:8181/v1/data/httpapi/authz".
+	// Required.
+	URL string
+
+	// Client is HTTP client used to request decisions.
+	// Optional. Default value http.DefaultClient.
+	Client *http.Client
+
+	// Timeout is maximum duration of decision request. Request timing out or failing otherwise is denied (fail closed).
+	// Optional. Default value 2 seconds.
+	Timeout time.Duration
+
+	// Headers are names of request headers included in PDPInput.Headers. Other headers are not sent to the decision
+	// endpoint.
+	// Optional.
+	Headers []string
+
+	// CacheTTL is duration decisions are cached for. Decisions are cached by whole input so requests with same claims
+	// and request attributes share the decision. Failed decision requests are not cached.
+	// Optional. Default value 0, decisions are not cached.
+	CacheTTL time.Duration
+
+	// CacheSize is maximum number of cached decisions. When cache is full the least recently used decision is evicted.
+	// Optional. Default value 10000.
+	CacheSize int
+
+	// ErrorHandler defines a function which is executed when request is denied. Error is PDPDeniedError when decision
+	// point denied the request or decision request error when decision could not be made.
+	// Optional. Default behaviour is to return "403 - Forbidden" error with deny reason as message.
+	ErrorHandler func(c *echo.Context, err error) error
+}
+
+// PDPInput is input sent to the decision endpoint.
+type PDPInput struct {
+	Claims  jwt.MapClaims     `json:"claims"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Route   string            `json:"route"`
+	Params  map[string]string `json:"params,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// PDPDecision is decision returned by the decision endpoint.
+type PDPDecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PDPDeniedError is error returned when decision point denied the request.
+type PDPDeniedError struct {
+	Reason string
+}
+
+// Error returns error message.
+func (e *PDPDeniedError) Error() string {
+	if e.Reason == "" {
+		return "policy decision denied"
+	}
+	return "policy decision denied: " + e.Reason
+}
+
+// PDP returns external policy decision point authorization middleware for decision endpoint URL or panics if
+// configuration is invalid.
+func PDP(url string) echo.MiddlewareFunc {
+	return PDPWithConfig(PDPConfig{URL: url})
+}
+
+// PDPWithConfig returns external policy decision point authorization middleware or panics if configuration is invalid.
+//
+// For denied request, middleware returns "403 - Forbidden" error.
+func PDPWithConfig(config PDPConfig) echo.MiddlewareFunc {
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		panic(err)
+	}
+	return mw
+}
+
+// ToMiddleware converts PDPConfig to middleware or returns an error for invalid configuration
+func (config PDPConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if config.URL == "" {
+		return nil, errors.New("jwt pdp middleware requires url")
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = 10000
+	}
+	cache := newPDPCache(config.CacheTTL, config.CacheSize)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			input, err := config.input(c)
+			if err != nil {
+				return ErrJWTInvalid.Wrap(err)
+			}
+			body, err := json.Marshal(map[string]interface{}{"input": input})
+			if err != nil {
+				return ErrJWTInvalid.Wrap(err)
+			}
+
+			key := sha256.Sum256(body)
+			decision, ok := cache.get(key)
+			if !ok {
+				decision, err = config.decide(c.Request().Context(), body)
+				if err == nil {
+					cache.set(key, decision)
+				}
+			}
+			if err == nil && decision.Allow {
+				return next(c)
+			}
+			if err == nil {
+				err = &PDPDeniedError{Reason: decision.Reason}
+			}
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(c, err)
+			}
+			message := ErrPolicyDenied.Message
+			if denied, ok := err.(*PDPDeniedError); ok && denied.Reason != "" {
+				message = denied.Reason
+			}
+			return echo.NewHTTPError(http.StatusForbidden, message).Wrap(err)
+		}
+	}, nil
+}
+
+func (config PDPConfig) input(c *echo.Context) (*PDPInput, error) {
+	input := &PDPInput{
+		Claims: jwt.MapClaims{},
+		Method: c.Request().Method,
+		Path:   c.Request().URL.Path,
+		Route:  c.Path(),
+	}
+	if token, err := tokenFromContext(c, config.ContextKey); err == nil {
+		if input.Claims, err = claimsToMap(token.Claims); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range c.PathValues() {
+		if input.Params == nil {
+			input.Params = map[string]string{}
+		}
+		input.Params[p.Name] = p.Value
+	}
+	for _, name := range config.Headers {
+		if v := c.Request().Header.Get(name); v != "" {
+			if input.Headers == nil {
+				input.Headers = map[string]string{}
+			}
+			input.Headers[name] = v
+		}
+	}
+	return input, nil
+}
+
+// decide requests decision from the decision endpoint.
+func (config PDPConfig) decide(ctx context.Context, body []byte) (PDPDecision, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return PDPDecision{}, fmt.Errorf("jwt pdp decision request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	res, err := config.Client.Do(req)
+	if err != nil {
+		return PDPDecision{}, fmt.Errorf("jwt pdp decision request failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return PDPDecision{}, fmt.Errorf("jwt pdp decision request failed: unexpected status code %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, pdpMaxResponseSize+1))
+	if err != nil {
+		return PDPDecision{}, fmt.Errorf("jwt pdp decision request failed: %w", err)
+	}
+	if len(data) > pdpMaxResponseSize {
+		return PDPDecision{}, errors.New("jwt pdp decision request failed: response is too large")
+	}
+	return parsePDPDecision(data)
+}
+
+// parsePDPDecision parses decision endpoint response. Missing result (i.e. undefined decision) is deny.
+func parsePDPDecision(data []byte) (PDPDecision, error) {
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return PDPDecision{}, fmt.Errorf("jwt pdp decision could not be parsed: %w", err)
+	}
+	var decision PDPDecision
+	if len(response.Result) == 0 || string(response.Result) == "null" {
+		return decision, nil
+	}
+	if err := json.Unmarshal(response.Result, &decision.Allow); err == nil {
+		return decision, nil
+	}
+	if err := json.Unmarshal(response.Result, &decision); err != nil {
+		return PDPDecision{}, fmt.Errorf("jwt pdp decision could not be parsed: %w", err)
+	}
+	return decision, nil
+}
+
+// pdpCache caches decisions by input hash for TTL. When cache is full the least recently used decision is evicted.
+type pdpCache struct {
+	ttl     time.Duration
+	entries *lruCache[[sha256.Size]byte, pdpCacheEntry]
+}
+
+type pdpCacheEntry struct {
+	decision  PDPDecision
+	expiresAt time.Time
+}
+
+func newPDPCache(ttl time.Duration, size int) *pdpCache {
+	return &pdpCache{ttl: ttl, entries: newLRUCache[[sha256.Size]byte, pdpCacheEntry](size)}
+}
+
+func (pc *pdpCache) get(key [sha256.Size]byte) (PDPDecision, bool) {
+	if pc.ttl <= 0 {
+		return PDPDecision{}, false
+	}
+	e, ok := pc.entries.get(key)
+	if !ok {
+		return PDPDecision{}, false
+	}
+	if time.Now().After(e.expiresAt) {
+		pc.entries.remove(key)
+		return PDPDecision{}, false
+	}
+	return e.decision, true
+}
+
+func (pc *pdpCache) set(key [sha256.Size]byte, decision PDPDecision) {
+	if pc.ttl <= 0 {
+		return
+	}
+	pc.entries.set(key, pdpCacheEntry{decision: decision, expiresAt: time.Now().Add(pc.ttl)})
+}
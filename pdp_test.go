@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestPDPServer starts stand-in decision server allowing requests where `org_id` claim equals `org` path param.
+func newTestPDPServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var body struct {
+			Input PDPInput `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case body.Input.Params["org"] == "slow":
+			time.Sleep(200 * time.Millisecond)
+		case body.Input.Params["org"] == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case body.Input.Params["org"] == "undefined":
+			_, _ = w.Write([]byte(`{}`))
+			return
+		case body.Input.Headers["X-Debug-Allow"] == "true":
+			_, _ = w.Write([]byte(`{"result": true}`))
+			return
+		}
+		decision := PDPDecision{Allow: body.Input.Claims["org_id"] == body.Input.Params["org"] && body.Input.Route == "/orgs/:org"}
+		if !decision.Allow {
+			decision.Reason = "organization mismatch"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": decision})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func servePDP(t *testing.T, mw echo.MiddlewareFunc, claims jwt.MapClaims, path string, headers map[string]string) (int, error) {
+	e := echo.New()
+	var handlerErr error
+	e.HTTPErrorHandler = func(c *echo.Context, err error) {
+		handlerErr = err
+	}
+	e.GET("/orgs/:org", func(c *echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if claims != nil {
+				c.Set("user", &jwt.Token{Claims: claims})
+			}
+			return next(c)
+		}
+	}, mw)
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Code, handlerErr
+}
+
+func TestPDPConfig_ToMiddleware(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		whenClaims  jwt.MapClaims
+		whenPath    string
+		whenHeaders map[string]string
+		expectError string
+	}{
+		{
+			name:       "ok, allowed",
+			whenClaims: jwt.MapClaims{"org_id": "acme"},
+			whenPath:   "/orgs/acme",
+		},
+		{
+			name:        "ok, boolean result and configured header",
+			whenClaims:  jwt.MapClaims{"org_id": "acme"},
+			whenPath:    "/orgs/other",
+			whenHeaders: map[string]string{"X-Debug-Allow": "true"},
+		},
+		{
+			name:        "nok, denied with reason",
+			whenClaims:  jwt.MapClaims{"org_id": "acme"},
+			whenPath:    "/orgs/other",
+			expectError: "code=403, message=organization mismatch, err=policy decision denied: organization mismatch",
+		},
+		{
+			name:        "nok, without token",
+			whenPath:    "/orgs/acme",
+			expectError: "code=403, message=organization mismatch, err=policy decision denied: organization mismatch",
+		},
+		{
+			name:        "nok, undefined decision",
+			whenClaims:  jwt.MapClaims{"org_id": "undefined"},
+			whenPath:    "/orgs/undefined",
+			expectError: "code=403, message=access denied by policy, err=policy decision denied",
+		},
+		{
+			name:        "nok, fail closed on timeout",
+			whenClaims:  jwt.MapClaims{"org_id": "slow"},
+			whenPath:    "/orgs/slow",
+			expectError: `code=403, message=access denied by policy, err=jwt pdp decision request failed: Post "URL": context deadline exceeded`,
+		},
+		{
+			name:        "nok, fail closed on server error",
+			whenClaims:  jwt.MapClaims{"org_id": "broken"},
+			whenPath:    "/orgs/broken",
+			expectError: "code=403, message=access denied by policy, err=jwt pdp decision request failed: unexpected status code 500",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := &atomic.Int32{}
+			server := newTestPDPServer(t, requests)
+			mw := PDPWithConfig(PDPConfig{
+				URL:     server.URL,
+				Timeout: 50 * time.Millisecond,
+				Headers: []string{"X-Debug-Allow"},
+			})
+
+			code, err := servePDP(t, mw, tc.whenClaims, tc.whenPath, tc.whenHeaders)
+
+			if tc.expectError != "" {
+				assert.EqualError(t, err, strings.Replace(tc.expectError, "URL", server.URL, 1))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, int32(1), requests.Load())
+		})
+	}
+}
+
+func TestPDPConfig_CacheTTL(t *testing.T) {
+	requests := &atomic.Int32{}
+	server := newTestPDPServer(t, requests)
+	mw := PDPWithConfig(PDPConfig{URL: server.URL, CacheTTL: 200 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		code, err := servePDP(t, mw, jwt.MapClaims{"org_id": "acme"}, "/orgs/acme", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	_, err := servePDP(t, mw, jwt.MapClaims{"org_id": "acme"}, "/orgs/other", nil)
+	assert.EqualError(t, err, "code=403, message=organization mismatch, err=policy decision denied: organization mismatch")
+	_, err = servePDP(t, mw, jwt.MapClaims{"org_id": "acme"}, "/orgs/other", nil)
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	time.Sleep(250 * time.Millisecond)
+	_, err = servePDP(t, mw, jwt.MapClaims{"org_id": "acme"}, "/orgs/acme", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), requests.Load())
+
+	// failed decision requests are not cached
+	_, _ = servePDP(t, mw, jwt.MapClaims{"org_id": "broken"}, "/orgs/broken", nil)
+	_, _ = servePDP(t, mw, jwt.MapClaims{"org_id": "broken"}, "/orgs/broken", nil)
+	assert.Equal(t, int32(5), requests.Load())
+}
+
+func TestPDPConfig_CacheSize(t *testing.T) {
+	requests := &atomic.Int32{}
+	server := newTestPDPServer(t, requests)
+	mw := PDPWithConfig(PDPConfig{URL: server.URL, CacheTTL: time.Minute, CacheSize: 2})
+
+	for _, org := range []string{"a", "b", "a", "c", "c", "a", "b"} {
+		_, err := servePDP(t, mw, jwt.MapClaims{"org_id": org}, "/orgs/"+org, nil)
+		assert.NoError(t, err)
+	}
+	// "b" is evicted when decision of "c" is cached, "a" is kept as recently used
+	assert.Equal(t, int32(4), requests.Load())
+}
+
+func TestPDPConfig_ErrorHandler(t *testing.T) {
+	requests := &atomic.Int32{}
+	server := newTestPDPServer(t, requests)
+	var handlerErr error
+	mw := PDPWithConfig(PDPConfig{
+		URL: server.URL,
+		ErrorHandler: func(c *echo.Context, err error) error {
+			handlerErr = err
+			return echo.ErrNotFound
+		},
+	})
+
+	_, err := servePDP(t, mw, jwt.MapClaims{"org_id": "acme"}, "/orgs/other", nil)
+
+	assert.Equal(t, echo.ErrNotFound, err)
+	var denied *PDPDeniedError
+	assert.True(t, errors.As(handlerErr, &denied))
+	assert.Equal(t, "organization mismatch", denied.Reason)
+}
+
+func TestParsePDPDecision(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		whenData    string
+		expect      PDPDecision
+		expectError string
+	}{
+		{name: "ok, boolean allow", whenData: `{"result": true}`, expect: PDPDecision{Allow: true}},
+		{name: "ok, boolean deny", whenData: `{"result": false}`, expect: PDPDecision{}},
+		{
+			name:     "ok, object",
+			whenData: `{"result": {"allow": false, "reason": "suspended"}}`,
+			expect:   PDPDecision{Reason: "suspended"},
+		},
+		{name: "ok, undefined result", whenData: `{"decision_id": "x"}`, expect: PDPDecision{}},
+		{name: "ok, null result", whenData: `{"result": null}`, expect: PDPDecision{}},
+		{
+			name:        "nok, invalid json",
+			whenData:    `{`,
+			expectError: "jwt pdp decision could not be parsed: unexpected end of JSON input",
+		},
+		{
+			name:        "nok, invalid result",
+			whenData:    `{"result": "yes"}`,
+			expectError: "jwt pdp decision could not be parsed: json: cannot unmarshal string into Go value of type echojwt.PDPDecision",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, err := parsePDPDecision([]byte(tc.whenData))
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, decision)
+		})
+	}
+}
+
+func TestPDPConfig_ToMiddleware_error(t *testing.T) {
+	_, err := PDPConfig{}.ToMiddleware()
+	assert.EqualError(t, err, "jwt pdp middleware requires url")
+
+	assert.Panics(t, func() { PDP("") })
+}
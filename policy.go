@@ -0,0 +1,537 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+// Policy is compiled authorization policy expression. Expression is evaluated against claims of the token stored in
+// context by JWT middleware, Principal and the request.
+//
+// Expression syntax:
+//   - operands:
+//   - `claim.<path>` token claim at claim path, see PrincipalMapping for path syntax. For example `claim.org_id`,
+//     `claim.realm_access.roles` or `claim["https://example.com/roles"]`.
+//   - `principal.<field>` Principal field: `subject`, `tenant`, `roles`, `scopes`, `email`, `scheme` or
+//     `impersonator`.
+//   - `param.<name>` path parameter, `query.<name>` query parameter, `header.<name>` request header.
+//   - `method` request method, `path` request URL path.
+//   - string literal in double quotes, number, `true` and `false`.
+//   - comparison: `a == b`, `a != b`. Values are compared as strings, numbers are formatted without exponent. Missing
+//     claims and empty request values are never equal to anything.
+//   - membership: `a in b` is true when b is an array containing a or a space separated string containing a.
+//   - logical operators: `!a`, `a && b`, `a || b` and parentheses. Single operand is true when its value is boolean
+//     true.
+//
+// Example: `claim.org_id == param.org || "admin" in claim.roles`
+type Policy struct {
+	expr string
+	root policyNode
+}
+
+// AuthorizeConfig defines the config for authorization policy middleware.
+//
+// Authorization middleware must be executed after JWT middleware or AuthChain.
+type AuthorizeConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// ContextKey is key where JWT middleware stored the token in context. When there is no token in context (i.e.
+	// optional authentication or other authentication scheme) policy is evaluated with empty claims.
+	// Optional. Default value "user".
+	ContextKey string
+
+	// Policy is authorization policy expression. See Policy for syntax. Expression is compiled when middleware is
+	// created.
+	// Required.
+	Policy string
+
+	// ErrorHandler defines a function which is executed when policy denies the request. Error is ErrPolicyDenied.
+	// Optional. Default behaviour is to return the error.
+	ErrorHandler func(c *echo.Context, err error) error
+}
+
+// ErrPolicyDenied denotes an error raised when authorization policy denies the request
+var ErrPolicyDenied = echo.NewHTTPError(http.StatusForbidden, "access denied by policy")
+
+// Authorize returns authorization middleware allowing only requests matching policy expression or panics if
+// expression is invalid.
+func Authorize(policy string) echo.MiddlewareFunc {
+	return AuthorizeWithConfig(AuthorizeConfig{Policy: policy})
+}
+
+// AuthorizeWithConfig returns authorization middleware or panics if configuration is invalid.
+//
+// For request not matching the policy, middleware returns "403 - Forbidden" error.
+func AuthorizeWithConfig(config AuthorizeConfig) echo.MiddlewareFunc {
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		panic(err)
+	}
+	return mw
+}
+
+// ToMiddleware converts AuthorizeConfig to middleware or returns an error for invalid configuration
+func (config AuthorizeConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if config.Policy == "" {
+		return nil, errors.New("jwt authorize middleware requires policy")
+	}
+	policy, err := CompilePolicy(config.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			claims := jwt.MapClaims{}
+			if token, err := tokenFromContext(c, config.ContextKey); err == nil {
+				if claims, err = claimsToMap(token.Claims); err != nil {
+					return ErrJWTInvalid.Wrap(err)
+				}
+			}
+			if policy.Allow(c, claims) {
+				return next(c)
+			}
+			err := ErrPolicyDenied.Wrap(fmt.Errorf("policy denied: %v", policy))
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(c, err)
+			}
+			return err
+		}
+	}, nil
+}
+
+// CompilePolicy compiles authorization policy expression. See Policy for syntax.
+func CompilePolicy(expr string) (*Policy, error) {
+	p := &policyParser{expr: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != policyTokenEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return &Policy{expr: expr, root: root}, nil
+}
+
+// MustCompilePolicy compiles authorization policy expression or panics if expression is invalid.
+func MustCompilePolicy(expr string) *Policy {
+	p, err := CompilePolicy(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the policy expression.
+func (p *Policy) String() string {
+	return p.expr
+}
+
+// Allow evaluates the policy for the request with given token claims and Principal stored in context.
+func (p *Policy) Allow(c *echo.Context, claims jwt.MapClaims) bool {
+	env := &policyEnv{c: c, claims: claims, principal: PrincipalFromContext(c)}
+	if env.principal == nil {
+		env.principal = &Principal{}
+	}
+	return p.root.eval(env)
+}
+
+type policyEnv struct {
+	c         *echo.Context
+	claims    jwt.MapClaims
+	principal *Principal
+}
+
+// policyNode is boolean expression node
+type policyNode interface {
+	eval(env *policyEnv) bool
+}
+
+// policyOperand is value expression node. Value is nil for missing values.
+type policyOperand interface {
+	value(env *policyEnv) interface{}
+}
+
+type orNode struct{ left, right policyNode }
+
+func (n orNode) eval(env *policyEnv) bool { return n.left.eval(env) || n.right.eval(env) }
+
+type andNode struct{ left, right policyNode }
+
+func (n andNode) eval(env *policyEnv) bool { return n.left.eval(env) && n.right.eval(env) }
+
+type notNode struct{ node policyNode }
+
+func (n notNode) eval(env *policyEnv) bool { return !n.node.eval(env) }
+
+type compareNode struct {
+	op          string
+	left, right policyOperand
+}
+
+func (n compareNode) eval(env *policyEnv) bool {
+	left, right := n.left.value(env), n.right.value(env)
+	switch n.op {
+	case "==":
+		return policyEqual(left, right)
+	case "!=":
+		return !policyEqual(left, right)
+	}
+	// "in"
+	switch r := right.(type) {
+	case string:
+		return slices.ContainsFunc(strings.Fields(r), func(v string) bool { return policyEqual(left, v) })
+	case []interface{}:
+		return slices.ContainsFunc(r, func(v interface{}) bool { return policyEqual(left, v) })
+	case []string:
+		return slices.ContainsFunc(r, func(v string) bool { return policyEqual(left, v) })
+	}
+	return false
+}
+
+type truthNode struct{ operand policyOperand }
+
+func (n truthNode) eval(env *policyEnv) bool {
+	v, _ := n.operand.value(env).(bool)
+	return v
+}
+
+type literalOperand struct{ v interface{} }
+
+func (o literalOperand) value(env *policyEnv) interface{} { return o.v }
+
+type claimOperand struct{ path *claimPath }
+
+func (o claimOperand) value(env *policyEnv) interface{} {
+	v, _ := o.path.lookup(env.claims)
+	return v
+}
+
+type requestOperand struct {
+	get func(c *echo.Context) string
+}
+
+func (o requestOperand) value(env *policyEnv) interface{} {
+	if v := o.get(env.c); v != "" {
+		return v
+	}
+	return nil
+}
+
+type principalOperand struct {
+	get func(p *Principal) interface{}
+}
+
+func (o principalOperand) value(env *policyEnv) interface{} {
+	return o.get(env.principal)
+}
+
+// principalFields are Principal fields accessible in policy expressions
+var principalFields = map[string]func(p *Principal) interface{}{
+	"subject":      func(p *Principal) interface{} { return nonEmpty(p.Subject) },
+	"tenant":       func(p *Principal) interface{} { return nonEmpty(p.Tenant) },
+	"roles":        func(p *Principal) interface{} { return p.Roles },
+	"scopes":       func(p *Principal) interface{} { return p.Scopes },
+	"email":        func(p *Principal) interface{} { return nonEmpty(p.Email) },
+	"scheme":       func(p *Principal) interface{} { return nonEmpty(p.Scheme) },
+	"impersonator": func(p *Principal) interface{} { return nonEmpty(p.Impersonator) },
+}
+
+func nonEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// policyEqual compares scalar values as strings. Missing values and non-scalar values are never equal.
+func policyEqual(a interface{}, b interface{}) bool {
+	as, ok := policyString(a)
+	if !ok {
+		return false
+	}
+	bs, ok := policyString(b)
+	return ok && as == bs
+}
+
+func policyString(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	return "", false
+}
+
+const (
+	policyTokenEOF = iota
+	policyTokenRef
+	policyTokenString
+	policyTokenNumber
+	policyTokenOperator
+)
+
+type policyToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+type policyParser struct {
+	expr   string
+	tokens []policyToken
+	i      int
+}
+
+func (p *policyParser) errorf(t policyToken, format string, args ...interface{}) error {
+	return fmt.Errorf("jwt policy %q: %v at position %d", p.expr, fmt.Sprintf(format, args...), t.pos)
+}
+
+func (p *policyParser) peek() policyToken {
+	return p.tokens[p.i]
+}
+
+func (p *policyParser) next() policyToken {
+	t := p.tokens[p.i]
+	if t.kind != policyTokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *policyParser) tokenize() error {
+	s := p.expr
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(s[i:], "==") || strings.HasPrefix(s[i:], "!=") ||
+			strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||"):
+			p.tokens = append(p.tokens, policyToken{kind: policyTokenOperator, text: s[i : i+2], pos: i})
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			p.tokens = append(p.tokens, policyToken{kind: policyTokenOperator, text: s[i : i+1], pos: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return p.errorf(policyToken{pos: i}, "unterminated string")
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return p.errorf(policyToken{pos: i}, "invalid string")
+			}
+			p.tokens = append(p.tokens, policyToken{kind: policyTokenString, text: text, pos: i})
+			i = end + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			end := i + 1
+			for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+				end++
+			}
+			p.tokens = append(p.tokens, policyToken{kind: policyTokenNumber, text: s[i:end], pos: i})
+			i = end
+		case isPolicyRefStart(c):
+			end := i + 1
+			for end < len(s) {
+				if strings.HasPrefix(s[end:], `["`) {
+					closing := strings.Index(s[end:], `"]`)
+					if closing < 0 {
+						return p.errorf(policyToken{pos: end}, "missing closing bracket")
+					}
+					end += closing + 2
+					continue
+				}
+				if !isPolicyRefStart(s[end]) && !(s[end] >= '0' && s[end] <= '9') && s[end] != '.' && s[end] != '-' {
+					break
+				}
+				end++
+			}
+			p.tokens = append(p.tokens, policyToken{kind: policyTokenRef, text: s[i:end], pos: i})
+			i = end
+		default:
+			return p.errorf(policyToken{pos: i}, "unexpected character %q", c)
+		}
+	}
+	p.tokens = append(p.tokens, policyToken{kind: policyTokenEOF, pos: len(s)})
+	return nil
+}
+
+func isPolicyRefStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func (p *policyParser) parseOr() (policyNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "||" && p.peek().kind == policyTokenOperator {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *policyParser) parseAnd() (policyNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "&&" && p.peek().kind == policyTokenOperator {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *policyParser) parseNot() (policyNode, error) {
+	t := p.peek()
+	if t.kind == policyTokenOperator && t.text == "!" {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	}
+	if t.kind == policyTokenOperator && t.text == "(" {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != policyTokenOperator || closing.text != ")" {
+			return nil, p.errorf(closing, "expected \")\"")
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *policyParser) parseComparison() (policyNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	isCompare := t.kind == policyTokenOperator && (t.text == "==" || t.text == "!=")
+	if !isCompare && !(t.kind == policyTokenRef && t.text == "in") {
+		return truthNode{operand: left}, nil
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op: t.text, left: left, right: right}, nil
+}
+
+func (p *policyParser) parseOperand() (policyOperand, error) {
+	t := p.next()
+	switch t.kind {
+	case policyTokenString:
+		return literalOperand{v: t.text}, nil
+	case policyTokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return literalOperand{v: f}, nil
+	case policyTokenRef:
+		return p.parseRef(t)
+	case policyTokenEOF:
+		return nil, p.errorf(t, "unexpected end of expression")
+	}
+	return nil, p.errorf(t, "unexpected %q", t.text)
+}
+
+func (p *policyParser) parseRef(t policyToken) (policyOperand, error) {
+	root, rest := t.text, ""
+	if i := strings.IndexAny(t.text, ".["); i >= 0 {
+		root, rest = t.text[:i], strings.TrimPrefix(t.text[i:], ".")
+	}
+	if rest == "" {
+		switch root {
+		case "true":
+			return literalOperand{v: true}, nil
+		case "false":
+			return literalOperand{v: false}, nil
+		case "method":
+			return requestOperand{get: func(c *echo.Context) string { return c.Request().Method }}, nil
+		case "path":
+			return requestOperand{get: func(c *echo.Context) string { return c.Request().URL.Path }}, nil
+		case "claim", "principal", "param", "query", "header":
+			return nil, p.errorf(t, "%v requires name", root)
+		}
+		return nil, p.errorf(t, "unknown operand %q", t.text)
+	}
+
+	switch root {
+	case "claim":
+		path, err := parseClaimPath(rest)
+		if err != nil {
+			return nil, p.errorf(t, "%v", err)
+		}
+		return claimOperand{path: path}, nil
+	case "principal":
+		get, ok := principalFields[rest]
+		if !ok {
+			return nil, p.errorf(t, "unknown principal field %q", rest)
+		}
+		return principalOperand{get: get}, nil
+	}
+	if strings.ContainsAny(rest, ".[") {
+		return nil, p.errorf(t, "invalid %v name %q", root, rest)
+	}
+	switch root {
+	case "param":
+		return requestOperand{get: func(c *echo.Context) string { return c.Param(rest) }}, nil
+	case "query":
+		return requestOperand{get: func(c *echo.Context) string { return c.QueryParam(rest) }}, nil
+	case "header":
+		return requestOperand{get: func(c *echo.Context) string { return c.Request().Header.Get(rest) }}, nil
+	}
+	return nil, p.errorf(t, "unknown operand %q", t.text)
+}
@@ -0,0 +1,307 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilePolicy_error(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		whenExpr    string
+		expectError string
+	}{
+		{name: "nok, empty", whenExpr: "", expectError: `jwt policy "": unexpected end of expression at position 0`},
+		{name: "nok, unknown operand", whenExpr: "user.id == 1", expectError: `jwt policy "user.id == 1": unknown operand "user.id" at position 0`},
+		{name: "nok, claim without name", whenExpr: "claim", expectError: `jwt policy "claim": claim requires name at position 0`},
+		{
+			name:        "nok, invalid claim path",
+			whenExpr:    "claim.a..b == 1",
+			expectError: `jwt policy "claim.a..b == 1": invalid claim path "a..b": empty claim name at position 0`,
+		},
+		{
+			name:        "nok, unknown principal field",
+			whenExpr:    `principal.name == "joe"`,
+			expectError: `jwt policy "principal.name == \"joe\"": unknown principal field "name" at position 0`,
+		},
+		{
+			name:        "nok, nested param name",
+			whenExpr:    `param.a.b == "x"`,
+			expectError: `jwt policy "param.a.b == \"x\"": invalid param name "a.b" at position 0`,
+		},
+		{
+			name:        "nok, missing right operand",
+			whenExpr:    `claim.sub ==`,
+			expectError: `jwt policy "claim.sub ==": unexpected end of expression at position 12`,
+		},
+		{
+			name:        "nok, unclosed parenthesis",
+			whenExpr:    `(claim.admin`,
+			expectError: `jwt policy "(claim.admin": expected ")" at position 12`,
+		},
+		{
+			name:        "nok, trailing tokens",
+			whenExpr:    `claim.admin claim.root`,
+			expectError: `jwt policy "claim.admin claim.root": unexpected "claim.root" at position 12`,
+		},
+		{
+			name:        "nok, unterminated string",
+			whenExpr:    `claim.sub == "joe`,
+			expectError: `jwt policy "claim.sub == \"joe": unterminated string at position 13`,
+		},
+		{
+			name:        "nok, unexpected character",
+			whenExpr:    `claim.sub = "joe"`,
+			expectError: `jwt policy "claim.sub = \"joe\"": unexpected character '=' at position 10`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := CompilePolicy(tc.whenExpr)
+			assert.EqualError(t, err, tc.expectError)
+			assert.Nil(t, p)
+		})
+	}
+}
+
+func TestPolicy_Allow(t *testing.T) {
+	var testCases = []struct {
+		name           string
+		givenPolicy    string
+		whenClaims     jwt.MapClaims
+		whenPrincipal  *Principal
+		whenMethod     string
+		whenHeaders    map[string]string
+		whenPathValues echo.PathValues
+		expect         bool
+	}{
+		{
+			name:           "ok, claim equals path param",
+			givenPolicy:    `claim.org_id == param.org || "admin" in claim.roles`,
+			whenClaims:     jwt.MapClaims{"org_id": "acme", "roles": []interface{}{"user"}},
+			whenPathValues: echo.PathValues{{Name: "org", Value: "acme"}},
+			expect:         true,
+		},
+		{
+			name:           "ok, roles contain admin",
+			givenPolicy:    `claim.org_id == param.org || "admin" in claim.roles`,
+			whenClaims:     jwt.MapClaims{"org_id": "other", "roles": []interface{}{"user", "admin"}},
+			whenPathValues: echo.PathValues{{Name: "org", Value: "acme"}},
+			expect:         true,
+		},
+		{
+			name:           "nok, other org without admin role",
+			givenPolicy:    `claim.org_id == param.org || "admin" in claim.roles`,
+			whenClaims:     jwt.MapClaims{"org_id": "other", "roles": []interface{}{"user"}},
+			whenPathValues: echo.PathValues{{Name: "org", Value: "acme"}},
+			expect:         false,
+		},
+		{
+			name:        "nok, missing claim does not equal missing param",
+			givenPolicy: `claim.org_id == param.org`,
+			whenClaims:  jwt.MapClaims{},
+			expect:      false,
+		},
+		{
+			name:           "ok, number claim equals param",
+			givenPolicy:    `claim.org.id == param.org && claim.org.id == 42`,
+			whenClaims:     jwt.MapClaims{"org": map[string]interface{}{"id": float64(42)}},
+			whenPathValues: echo.PathValues{{Name: "org", Value: "42"}},
+			expect:         true,
+		},
+		{
+			name:        "ok, scope in space separated string",
+			givenPolicy: `"write" in claim.scope && method == "POST"`,
+			whenClaims:  jwt.MapClaims{"scope": "read write"},
+			whenMethod:  http.MethodPost,
+			expect:      true,
+		},
+		{
+			name:        "nok, method does not match",
+			givenPolicy: `"write" in claim.scope && method == "POST"`,
+			whenClaims:  jwt.MapClaims{"scope": "read write"},
+			expect:      false,
+		},
+		{
+			name:        "ok, header and negation",
+			givenPolicy: `header.X-Tenant == claim["https://example.com/tenant"] && !claim.suspended`,
+			whenClaims:  jwt.MapClaims{"https://example.com/tenant": "acme", "suspended": false},
+			whenHeaders: map[string]string{"X-Tenant": "acme"},
+			expect:      true,
+		},
+		{
+			name:        "nok, boolean claim",
+			givenPolicy: `header.X-Tenant == claim["https://example.com/tenant"] && !claim.suspended`,
+			whenClaims:  jwt.MapClaims{"https://example.com/tenant": "acme", "suspended": true},
+			whenHeaders: map[string]string{"X-Tenant": "acme"},
+			expect:      false,
+		},
+		{
+			name:        "ok, parentheses and not equal",
+			givenPolicy: `(claim.sub != "root" || claim.mfa == true) && (method == "GET" || method == "HEAD")`,
+			whenClaims:  jwt.MapClaims{"sub": "root", "mfa": true},
+			expect:      true,
+		},
+		{
+			name:          "ok, principal fields",
+			givenPolicy:   `principal.scheme == "apikey" && "ops" in principal.roles`,
+			whenPrincipal: &Principal{Scheme: AuthSchemeAPIKey, Roles: []string{"ops"}},
+			expect:        true,
+		},
+		{
+			name:          "ok, impersonated principal",
+			givenPolicy:   `principal.impersonator == "admin-1" && principal.subject == "customer-42"`,
+			whenPrincipal: &Principal{Subject: "customer-42", Impersonator: "admin-1"},
+			expect:        true,
+		},
+		{
+			name:        "nok, missing principal",
+			givenPolicy: `principal.subject != "" && principal.subject == claim.sub`,
+			whenClaims:  jwt.MapClaims{"sub": ""},
+			expect:      false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := MustCompilePolicy(tc.givenPolicy)
+
+			method := tc.whenMethod
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			for k, v := range tc.whenHeaders {
+				req.Header.Set(k, v)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			if tc.whenPathValues != nil {
+				c.SetPathValues(tc.whenPathValues)
+			}
+			if tc.whenPrincipal != nil {
+				c.Set(PrincipalContextKey, tc.whenPrincipal)
+			}
+
+			assert.Equal(t, tc.expect, p.Allow(c, tc.whenClaims))
+			assert.Equal(t, tc.givenPolicy, p.String())
+		})
+	}
+}
+
+func TestAuthorizeConfig_ToMiddleware(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		givenConfig AuthorizeConfig
+		whenClaims  jwt.Claims
+		whenPath    string
+		expectError string
+	}{
+		{
+			name:        "ok, policy allows",
+			givenConfig: AuthorizeConfig{Policy: `claim.org_id == param.org`},
+			whenClaims:  jwt.MapClaims{"org_id": "acme"},
+			whenPath:    "/orgs/acme",
+		},
+		{
+			name:        "nok, policy denies",
+			givenConfig: AuthorizeConfig{Policy: `claim.org_id == param.org`},
+			whenClaims:  jwt.MapClaims{"org_id": "acme"},
+			whenPath:    "/orgs/other",
+			expectError: `code=403, message=access denied by policy, err=policy denied: claim.org_id == param.org`,
+		},
+		{
+			name:        "ok, custom claims struct",
+			givenConfig: AuthorizeConfig{Policy: `"admin" in claim.roles`},
+			whenClaims: &struct {
+				jwt.RegisteredClaims
+				Roles []string `json:"roles"`
+			}{Roles: []string{"admin"}},
+			whenPath: "/orgs/acme",
+		},
+		{
+			name:        "ok, without token policy is evaluated with empty claims",
+			givenConfig: AuthorizeConfig{Policy: `method == "GET" || claim.admin`},
+			whenPath:    "/orgs/acme",
+		},
+		{
+			name:        "nok, without token",
+			givenConfig: AuthorizeConfig{Policy: `claim.admin`},
+			whenPath:    "/orgs/acme",
+			expectError: `code=403, message=access denied by policy, err=policy denied: claim.admin`,
+		},
+		{
+			name: "ok, skipper",
+			givenConfig: AuthorizeConfig{
+				Policy:  `claim.admin`,
+				Skipper: func(c *echo.Context) bool { return true },
+			},
+			whenPath: "/orgs/acme",
+		},
+		{
+			name: "nok, custom error handler",
+			givenConfig: AuthorizeConfig{
+				Policy: `claim.admin`,
+				ErrorHandler: func(c *echo.Context, err error) error {
+					return echo.ErrNotFound
+				},
+			},
+			whenPath:    "/orgs/acme",
+			expectError: "Not Found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := tc.givenConfig.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := echo.New()
+			var handlerErr error
+			e.HTTPErrorHandler = func(c *echo.Context, err error) {
+				handlerErr = err
+			}
+			e.GET("/orgs/:org", func(c *echo.Context) error {
+				return c.String(http.StatusOK, "ok")
+			}, func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c *echo.Context) error {
+					if tc.whenClaims != nil {
+						c.Set("user", &jwt.Token{Claims: tc.whenClaims})
+					}
+					return next(c)
+				}
+			}, mw)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.whenPath, nil))
+
+			if tc.expectError != "" {
+				assert.EqualError(t, handlerErr, tc.expectError)
+				return
+			}
+			assert.NoError(t, handlerErr)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		})
+	}
+}
+
+func TestAuthorizeConfig_ToMiddleware_error(t *testing.T) {
+	_, err := AuthorizeConfig{}.ToMiddleware()
+	assert.EqualError(t, err, "jwt authorize middleware requires policy")
+
+	_, err = AuthorizeConfig{Policy: "claim..a"}.ToMiddleware()
+	assert.EqualError(t, err, `jwt policy "claim..a": invalid claim path ".a": empty claim name at position 0`)
+
+	assert.Panics(t, func() { Authorize("claim ==") })
+	assert.Panics(t, func() { MustCompilePolicy("") })
+}
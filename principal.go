@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+// PrincipalContextKey is context key the middleware stores Principal of the request under. The key is namespaced so it
+// does not collide with values applications store in context.
+const PrincipalContextKey = "echojwt.principal"
+
+const (
+	// AuthSchemeJWT is Principal.Scheme of principals authenticated with JWT.
+	AuthSchemeJWT = "jwt"
+	// AuthSchemeBasic is Principal.Scheme of principals authenticated with HTTP Basic authentication.
+	AuthSchemeBasic = "basic"
+	// AuthSchemeAPIKey is Principal.Scheme of principals authenticated with API key.
+	AuthSchemeAPIKey = "apikey"
+)
+
+// Principal is identity of the request. Middleware stores Principal in context under PrincipalContextKey next to the
+// token for authenticated requests and anonymous Principal for requests without token in optional authentication
+// mode. AuthChain stores Principal returned by the authenticator that succeeded, so handlers do not depend on the
+// authentication scheme.
+type Principal struct {
+	// Scheme is authentication scheme the principal was authenticated with, for example AuthSchemeJWT. Empty for
+	// anonymous principal.
+	Scheme string
+
+	// Subject is identifier of the authenticated user or client, for JWT it is `sub` claim of the token. Empty for
+	// anonymous principal.
+	Subject string
+
+	// Tenant is tenant (organization) the principal belongs to. Set from token when Config.PrincipalMapping maps it.
+	Tenant string
+
+	// Roles are roles of the principal. Set from token when Config.PrincipalMapping maps them.
+	Roles []string
+
+	// Scopes are scopes granted to the principal. Set from token when Config.PrincipalMapping is set.
+	Scopes []string
+
+	// Email is email address of the principal. Set from token when Config.PrincipalMapping is set.
+	Email string
+
+	// Impersonator is subject of the real user acting as Subject, read from `impersonator` claim of impersonation
+	// token. Empty when request is not impersonated. See ImpersonationConfig.
+	Impersonator string
+
+	// Anonymous is true when request did not contain credentials.
+	Anonymous bool
+}
+
+// PrincipalFromContext returns Principal stored in context by the middleware or nil when there is none.
+func PrincipalFromContext(c *echo.Context) *Principal {
+	p, _ := c.Get(PrincipalContextKey).(*Principal)
+	return p
+}
+
+// IsAuthenticated checks if the request was authenticated, meaning middleware stored non-anonymous Principal in context.
+func IsAuthenticated(c *echo.Context) bool {
+	p := PrincipalFromContext(c)
+	return p != nil && !p.Anonymous
+}
+
+// IsImpersonated checks if the principal is impersonated by another user.
+func (p *Principal) IsImpersonated() bool {
+	return p.Impersonator != ""
+}
+
+// RealSubject returns subject of the real user making the request: Impersonator for impersonated principal, Subject
+// otherwise. Subject is always the effective identity.
+func (p *Principal) RealSubject() string {
+	if p.Impersonator != "" {
+		return p.Impersonator
+	}
+	return p.Subject
+}
+
+// newAnonymousPrincipal creates principal for request without credentials.
+func newAnonymousPrincipal() *Principal {
+	return &Principal{Anonymous: true}
+}
+
+// newTokenPrincipal creates principal from token returned by ParseTokenFunc. Tokens of other types than *jwt.Token
+// result in principal without subject.
+func newTokenPrincipal(token interface{}) *Principal {
+	p := &Principal{Scheme: AuthSchemeJWT}
+	if t, ok := token.(*jwt.Token); ok && t.Claims != nil {
+		p.Subject, _ = t.Claims.GetSubject()
+	}
+	return p
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Optional(t *testing.T) {
+	var testCases = []struct {
+		name                string
+		whenAuthHeader      string
+		expectError         string
+		expectAuthenticated bool
+		expectPrincipal     *Principal
+	}{
+		{
+			name:                "ok, valid token",
+			whenAuthHeader:      "Bearer " + jwttest.NewToken("HS256").MustSign(t),
+			expectAuthenticated: true,
+			expectPrincipal:     &Principal{Scheme: AuthSchemeJWT, Subject: jwttest.DefaultSubject},
+		},
+		{
+			name:            "ok, missing token continues as anonymous",
+			expectPrincipal: &Principal{Anonymous: true},
+		},
+		{
+			name:            "ok, other authorization scheme continues as anonymous",
+			whenAuthHeader:  "Basic dXNlcjpwYXNz",
+			expectPrincipal: &Principal{Anonymous: true},
+		},
+		{
+			name:           "nok, expired token",
+			whenAuthHeader: "Bearer " + jwttest.NewToken("HS256").Expired().MustSign(t),
+			expectError:    "token has invalid claims: token is expired",
+		},
+		{
+			name:           "nok, malformed token",
+			whenAuthHeader: "Bearer !.b.c",
+			expectError:    "token is malformed: could not base64 decode header: illegal base64 data at input byte 0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			errorHandlerCalled := false
+			mw, err := Config{
+				SigningKey: jwttest.Key("HS256").PublicKey,
+				Optional:   true,
+				ErrorHandler: func(c *echo.Context, err error) error {
+					errorHandlerCalled = true
+					return err
+				},
+			}.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.whenAuthHeader != "" {
+				req.Header.Set(echo.HeaderAuthorization, tc.whenAuthHeader)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			var authenticated bool
+			var principal *Principal
+			err = mw(func(c *echo.Context) error {
+				authenticated = IsAuthenticated(c)
+				principal = PrincipalFromContext(c)
+				return nil
+			})(c)
+
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				assert.True(t, errorHandlerCalled)
+				return
+			}
+			assert.NoError(t, err)
+			assert.False(t, errorHandlerCalled)
+			assert.Equal(t, tc.expectAuthenticated, authenticated)
+			assert.Equal(t, tc.expectPrincipal, principal)
+		})
+	}
+}
+
+func TestIsAuthenticated(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.False(t, IsAuthenticated(c))
+	assert.Nil(t, PrincipalFromContext(c))
+
+	c.Set(PrincipalContextKey, &Principal{Anonymous: true})
+	assert.False(t, IsAuthenticated(c))
+
+	c.Set(PrincipalContextKey, &Principal{Subject: "user"})
+	assert.True(t, IsAuthenticated(c))
+}
+
+func TestConfig_PrincipalContextKey(t *testing.T) {
+	var testCases = []struct {
+		name              string
+		givenKey          string
+		whenToken         bool
+		expectPrincipalAt string
+	}{
+		{
+			name:              "ok, authenticated principal does not clobber application value",
+			whenToken:         true,
+			expectPrincipalAt: PrincipalContextKey,
+		},
+		{
+			name:              "ok, anonymous principal does not clobber application value",
+			expectPrincipalAt: PrincipalContextKey,
+		},
+		{
+			name:              "ok, custom key",
+			givenKey:          "auth.principal",
+			whenToken:         true,
+			expectPrincipalAt: "auth.principal",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := Config{
+				SigningKey:          jwttest.Key("HS256").PublicKey,
+				Optional:            true,
+				PrincipalContextKey: tc.givenKey,
+			}.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.whenToken {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+jwttest.NewToken("HS256").MustSign(t))
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			c.Set("principal", "application value")
+
+			err = mw(func(c *echo.Context) error { return nil })(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "application value", c.Get("principal"))
+			p, ok := c.Get(tc.expectPrincipalAt).(*Principal)
+			assert.True(t, ok)
+			assert.Equal(t, !tc.whenToken, p.Anonymous)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+// MIMEApplicationProblemJSON is media type of problem details document (RFC 9457)
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// ProblemConfig defines the config for ProblemErrorHandler.
+type ProblemConfig struct {
+	// TypeBase is URI prefix of problem type. Problem `type` member is TypeBase followed by ErrorKind, for example
+	// "https://example.com/problems/jwt/" results in "https://example.com/problems/jwt/expired".
+	// Optional. When empty `type` is "about:blank" and `title` is HTTP status text.
+	TypeBase string
+
+	// Extensions returns additional members added to the problem document. Members with names of standard members
+	// (`type`, `title`, `status`, `detail`, `instance`) are ignored. Note: do not add token or its claims here, the
+	// document is sent to the client and may end up in logs.
+	// Optional.
+	Extensions func(c *echo.Context, err error) map[string]interface{}
+}
+
+// Problem is problem details document (RFC 9457).
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+
+	// Extensions are additional members of the document.
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON encodes problem as JSON object with extension members on the same level as standard members.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	doc := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		doc[k] = v
+	}
+	doc["type"] = p.Type
+	doc["title"] = p.Title
+	doc["status"] = p.Status
+	if p.Detail != "" {
+		doc["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		doc["instance"] = p.Instance
+	}
+	return json.Marshal(doc)
+}
+
+// problemDetails are fixed title and detail per error kind. Error messages are never used as they may contain
+// attacker-controlled header values.
+var problemDetails = map[ErrorKind][2]string{
+	ErrorKindMissing:             {"Missing token", "Request does not contain an access token."},
+	ErrorKindMalformed:           {"Malformed token", "Access token could not be decoded."},
+	ErrorKindExpired:             {"Token expired", "Access token has expired."},
+	ErrorKindNotYetValid:         {"Token not yet valid", "Access token is not valid yet."},
+	ErrorKindBadSignature:        {"Invalid token signature", "Access token signature could not be verified."},
+	ErrorKindUnknownKeyID:        {"Unknown signing key", "Access token is signed with an unknown key."},
+	ErrorKindAlgorithmNotAllowed: {"Signing algorithm not allowed", "Access token is signed with an algorithm that is not allowed."},
+	ErrorKindAudienceMismatch:    {"Audience mismatch", "Access token is not intended for this audience."},
+	ErrorKindRevoked:             {"Token revoked", "Access token has been revoked."},
+	ErrorKindInvalid:             {"Invalid token", "Access token is invalid."},
+}
+
+// ProblemErrorHandler returns Config.ErrorHandler that responds with `401 Unauthorized` problem details document
+// (RFC 9457) describing why the token was rejected. Besides standard members the document contains `kind` member with
+// ErrorKind and, when the failure is caused by a single claim, `claim` member with the claim name. Document never
+// contains the token, its claims or underlying error messages.
+func ProblemErrorHandler(config ProblemConfig) func(c *echo.Context, err error) error {
+	return func(c *echo.Context, err error) error {
+		p := config.NewProblem(c, err)
+		b, mErr := json.Marshal(p)
+		if mErr != nil {
+			return mErr
+		}
+		return c.Blob(p.Status, MIMEApplicationProblemJSON, b)
+	}
+}
+
+// NewProblem creates problem details document for error returned by the middleware.
+func (config ProblemConfig) NewProblem(c *echo.Context, err error) Problem {
+	kind := ErrorKindOf(err)
+	details := problemDetails[kind]
+
+	p := Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(http.StatusUnauthorized),
+		Status:     http.StatusUnauthorized,
+		Detail:     details[1],
+		Instance:   c.Request().URL.Path,
+		Extensions: map[string]interface{}{},
+	}
+	if config.TypeBase != "" {
+		p.Type = config.TypeBase + string(kind)
+		p.Title = details[0]
+	}
+	if config.Extensions != nil {
+		for k, v := range config.Extensions(c, err) {
+			p.Extensions[k] = v
+		}
+	}
+	p.Extensions["kind"] = kind
+	if claim := failedClaim(err); claim != "" {
+		p.Extensions["claim"] = claim
+	}
+	return p
+}
+
+// failedClaim returns name of the registered claim that failed validation.
+func failedClaim(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "exp"
+	case errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "iat"
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return "nbf"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "aud"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "iss"
+	case errors.Is(err, jwt.ErrTokenInvalidSubject):
+		return "sub"
+	case errors.Is(err, jwt.ErrTokenInvalidId):
+		return "jti"
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemErrorHandler(t *testing.T) {
+	key := []byte("secret")
+	expired := createToken(t, jwt.SigningMethodHS256, key, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix(), "name": "secret-name"}, nil)
+
+	var testCases = []struct {
+		name        string
+		givenConfig ProblemConfig
+		whenToken   string
+		expectBody  string
+	}{
+		{
+			name:       "ok, missing token with default type",
+			expectBody: `{"detail":"Request does not contain an access token.","instance":"/api/users","kind":"missing","status":401,"title":"Unauthorized","type":"about:blank"}`,
+		},
+		{
+			name:        "ok, expired token with failing claim",
+			givenConfig: ProblemConfig{TypeBase: "https://example.com/problems/jwt/"},
+			whenToken:   expired,
+			expectBody:  `{"claim":"exp","detail":"Access token has expired.","instance":"/api/users","kind":"expired","status":401,"title":"Token expired","type":"https://example.com/problems/jwt/expired"}`,
+		},
+		{
+			name:        "ok, bad signature",
+			givenConfig: ProblemConfig{TypeBase: "https://example.com/problems/jwt/"},
+			whenToken:   createToken(t, jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{}, nil),
+			expectBody:  `{"detail":"Access token signature could not be verified.","instance":"/api/users","kind":"bad_signature","status":401,"title":"Invalid token signature","type":"https://example.com/problems/jwt/bad_signature"}`,
+		},
+		{
+			name: "ok, extensions can not override standard members",
+			givenConfig: ProblemConfig{
+				TypeBase: "https://example.com/problems/jwt/",
+				Extensions: func(c *echo.Context, err error) map[string]interface{} {
+					return map[string]interface{}{"trace_id": "123", "status": 200, "kind": "other"}
+				},
+			},
+			whenToken:  expired,
+			expectBody: `{"claim":"exp","detail":"Access token has expired.","instance":"/api/users","kind":"expired","status":401,"title":"Token expired","trace_id":"123","type":"https://example.com/problems/jwt/expired"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := Config{
+				SigningKey:   key,
+				TokenLookup:  "header:Authorization:Bearer ,query:token",
+				ErrorHandler: ProblemErrorHandler(tc.givenConfig),
+			}.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			target := "/api/users"
+			if tc.whenToken != "" {
+				target += "?token=" + tc.whenToken
+			}
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			res := httptest.NewRecorder()
+			c := echo.New().NewContext(req, res)
+
+			err = mw(func(c *echo.Context) error { return c.String(http.StatusOK, "ok") })(c)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusUnauthorized, res.Code)
+			assert.Equal(t, MIMEApplicationProblemJSON, res.Header().Get(echo.HeaderContentType))
+			assert.JSONEq(t, tc.expectBody, res.Body.String())
+			if tc.whenToken != "" {
+				assert.NotContains(t, res.Body.String(), tc.whenToken)
+			}
+			assert.NotContains(t, res.Body.String(), "secret-name")
+		})
+	}
+}
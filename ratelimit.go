@@ -0,0 +1,300 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+// RateLimit is number of requests allowed per time window.
+type RateLimit struct {
+	// Limit is number of requests allowed per Window.
+	Limit int
+	// Window is length of the time window.
+	Window time.Duration
+}
+
+// RateLimitResult is usage of rate limit after request was counted.
+type RateLimitResult struct {
+	// Allowed is true when request is within the limit.
+	Allowed bool
+	// Remaining is number of requests remaining in the current window.
+	Remaining int
+	// Reset is time until the current window ends.
+	Reset time.Duration
+}
+
+// RateLimitStore counts requests per key. Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	// Take counts request for the key and returns usage of the limit.
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimitConfig defines the config for rate limiting middleware. Rate limiting middleware limits requests per
+// subject of the token stored in context by JWT middleware instead of per IP address, so single account can not spread
+// requests across many addresses.
+//
+// Requests are keyed by the first of KeyClaims present in the token. Requests without token or without any key claim
+// are keyed by Principal subject (i.e. API key authenticated by AuthChain) or, when there is none, by client IP.
+//
+// Rate limiting middleware must be executed after JWT middleware. Responses contain `RateLimit-Limit`,
+// `RateLimit-Remaining`, `RateLimit-Reset` and `RateLimit-Policy` headers and `Retry-After` header when request is
+// rejected.
+type RateLimitConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// ContextKey is key where JWT middleware stored the token in context.
+	// Optional. Default value "user".
+	ContextKey string
+
+	// KeyClaims are claim paths requests are keyed by. The first claim present in the token is used. See
+	// PrincipalMapping for claim path syntax.
+	// Optional. Default value []string{"sub", "client_id"}.
+	KeyClaims []string
+
+	// Limit is default limit for a key.
+	// Required.
+	Limit RateLimit
+
+	// TierClaim is claim path of token tier (plan), for example "plan" or "subscription.tier".
+	// Optional.
+	TierClaim string
+
+	// Tiers are limits by TierClaim value. Tier limit takes precedence over scope limits and default limit.
+	// Optional.
+	Tiers map[string]RateLimit
+
+	// ScopeLimits are limits by token scope (`scope` or `scp` claim). When token has multiple scopes with limits the
+	// most generous limit is used. Scope limit takes precedence over default limit.
+	// Optional.
+	ScopeLimits map[string]RateLimit
+
+	// Store counts requests.
+	// Optional. Default value in-memory store created with NewRateLimitMemoryStore.
+	Store RateLimitStore
+
+	// ErrorHandler defines a function which is executed when request is rejected or store returns an error. Error is
+	// ErrRateLimitExceeded when limit is exceeded. Rate limit headers are already set on the response when
+	// ErrorHandler is called.
+	// Optional. Default behaviour is to return "429 - Too Many Requests" error or the store error.
+	ErrorHandler func(c *echo.Context, err error) error
+}
+
+// ErrRateLimitExceeded denotes an error raised when rate limit of the request key is exceeded
+var ErrRateLimitExceeded = echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+
+// RateLimitBySubject returns rate limiting middleware allowing limit requests per window for each token subject.
+func RateLimitBySubject(limit int, window time.Duration) echo.MiddlewareFunc {
+	return RateLimitWithConfig(RateLimitConfig{Limit: RateLimit{Limit: limit, Window: window}})
+}
+
+// RateLimitWithConfig returns rate limiting middleware or panics if configuration is invalid.
+//
+// For request exceeding the limit, middleware returns "429 - Too Many Requests" error.
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		panic(err)
+	}
+	return mw
+}
+
+// ToMiddleware converts RateLimitConfig to middleware or returns an error for invalid configuration
+func (config RateLimitConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if len(config.KeyClaims) == 0 {
+		config.KeyClaims = []string{"sub", "client_id"}
+	}
+	if config.Store == nil {
+		config.Store = NewRateLimitMemoryStore()
+	}
+	if err := config.Limit.validate(); err != nil {
+		return nil, fmt.Errorf("jwt rate limit middleware limit: %w", err)
+	}
+	for tier, limit := range config.Tiers {
+		if err := limit.validate(); err != nil {
+			return nil, fmt.Errorf("jwt rate limit middleware tier %v limit: %w", tier, err)
+		}
+	}
+	for scope, limit := range config.ScopeLimits {
+		if err := limit.validate(); err != nil {
+			return nil, fmt.Errorf("jwt rate limit middleware scope %v limit: %w", scope, err)
+		}
+	}
+	keyClaims := make([]*claimPath, 0, len(config.KeyClaims))
+	for _, name := range config.KeyClaims {
+		p, err := parseClaimPath(name)
+		if err != nil {
+			return nil, fmt.Errorf("jwt rate limit middleware key claim: %w", err)
+		}
+		keyClaims = append(keyClaims, p)
+	}
+	var tierClaim *claimPath
+	if config.TierClaim != "" {
+		var err error
+		if tierClaim, err = parseClaimPath(config.TierClaim); err != nil {
+			return nil, fmt.Errorf("jwt rate limit middleware tier claim: %w", err)
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			claims := jwt.MapClaims{}
+			if token, err := tokenFromContext(c, config.ContextKey); err == nil {
+				if claims, err = claimsToMap(token.Claims); err != nil {
+					return ErrJWTInvalid.Wrap(err)
+				}
+			}
+			key := rateLimitKey(c, claims, keyClaims)
+			limit := config.limit(claims, tierClaim)
+
+			res, err := config.Store.Take(c.Request().Context(), key, limit)
+			if err != nil {
+				if config.ErrorHandler != nil {
+					return config.ErrorHandler(c, err)
+				}
+				return err
+			}
+			setRateLimitHeaders(c.Response().Header(), limit, res)
+			if res.Allowed {
+				return next(c)
+			}
+			c.Response().Header().Set(echo.HeaderRetryAfter, strconv.FormatInt(rateLimitSeconds(res.Reset), 10))
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(c, ErrRateLimitExceeded)
+			}
+			return ErrRateLimitExceeded
+		}
+	}, nil
+}
+
+func (l RateLimit) validate() error {
+	if l.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if l.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	return nil
+}
+
+// limit returns limit of the token: tier limit, most generous scope limit or default limit.
+func (config RateLimitConfig) limit(claims jwt.MapClaims, tierClaim *claimPath) RateLimit {
+	if tierClaim != nil {
+		if limit, ok := config.Tiers[tierClaim.lookupString(claims)]; ok {
+			return limit
+		}
+	}
+	var best *RateLimit
+	for _, scope := range tokenScopes(claims) {
+		limit, ok := config.ScopeLimits[scope]
+		if ok && (best == nil || limit.rate() > best.rate()) {
+			best = &limit
+		}
+	}
+	if best != nil {
+		return *best
+	}
+	return config.Limit
+}
+
+// rate returns requests per second of the limit.
+func (l RateLimit) rate() float64 {
+	return float64(l.Limit) / l.Window.Seconds()
+}
+
+// rateLimitKey returns key of the request: the first present key claim, Principal subject or client IP.
+func rateLimitKey(c *echo.Context, claims jwt.MapClaims, keyClaims []*claimPath) string {
+	for _, p := range keyClaims {
+		if v := p.lookupString(claims); v != "" {
+			return "claim:" + p.raw + ":" + v
+		}
+	}
+	if p := PrincipalFromContext(c); p != nil && !p.Anonymous && p.Subject != "" {
+		return "principal:" + p.Scheme + ":" + p.Subject
+	}
+	return "ip:" + c.RealIP()
+}
+
+// setRateLimitHeaders sets RateLimit header fields (draft-ietf-httpapi-ratelimit-headers).
+func setRateLimitHeaders(h http.Header, limit RateLimit, res RateLimitResult) {
+	h.Set("RateLimit-Limit", strconv.Itoa(limit.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.FormatInt(rateLimitSeconds(res.Reset), 10))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Limit, rateLimitSeconds(limit.Window)))
+}
+
+// rateLimitSeconds rounds duration up to whole seconds.
+func rateLimitSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// RateLimitMemoryStore is in-memory fixed window RateLimitStore. Counters of ended windows are removed periodically.
+type RateLimitMemoryStore struct {
+	mu        sync.Mutex
+	windows   map[string]*rateLimitWindow
+	lastSweep time.Time
+
+	// timeNow is used in tests
+	timeNow func() time.Time
+}
+
+type rateLimitWindow struct {
+	start  time.Time
+	length time.Duration
+	count  int
+}
+
+// NewRateLimitMemoryStore creates in-memory RateLimitStore.
+func NewRateLimitMemoryStore() *RateLimitMemoryStore {
+	return &RateLimitMemoryStore{windows: map[string]*rateLimitWindow{}, timeNow: time.Now}
+}
+
+// Take counts request for the key and returns usage of the limit.
+func (s *RateLimitMemoryStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := s.timeNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, w := range s.windows {
+			if !now.Before(w.start.Add(w.length)) {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || w.length != limit.Window || !now.Before(w.start.Add(w.length)) {
+		w = &rateLimitWindow{start: now, length: limit.Window}
+		s.windows[key] = w
+	}
+	res := RateLimitResult{Allowed: w.count < limit.Limit, Reset: w.start.Add(w.length).Sub(now)}
+	if res.Allowed {
+		w.count++
+	}
+	res.Remaining = max(limit.Limit-w.count, 0)
+	return res, nil
+}
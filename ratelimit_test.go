@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type rateLimitRequest struct {
+	claims    jwt.MapClaims
+	principal *Principal
+	ip        string
+}
+
+func serveRateLimit(mw echo.MiddlewareFunc, r rateLimitRequest) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if r.ip != "" {
+		req.RemoteAddr = r.ip + ":1234"
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if r.claims != nil {
+		c.Set("user", &jwt.Token{Claims: r.claims})
+	}
+	if r.principal != nil {
+		c.Set(PrincipalContextKey, r.principal)
+	}
+	return rec, mw(func(c *echo.Context) error { return nil })(c)
+}
+
+func TestRateLimitConfig_ToMiddleware(t *testing.T) {
+	config := RateLimitConfig{
+		Limit:       RateLimit{Limit: 2, Window: time.Minute},
+		TierClaim:   "subscription.tier",
+		Tiers:       map[string]RateLimit{"pro": {Limit: 5, Window: time.Minute}},
+		ScopeLimits: map[string]RateLimit{"bulk": {Limit: 4, Window: time.Minute}, "batch": {Limit: 3, Window: time.Second}},
+	}
+
+	var testCases = []struct {
+		name          string
+		whenRequests  []rateLimitRequest
+		expectAllowed int
+		expectHeaders map[string]string
+	}{
+		{
+			name:          "ok, default limit per subject",
+			whenRequests:  []rateLimitRequest{{claims: jwt.MapClaims{"sub": "joe"}}},
+			expectAllowed: 2,
+			expectHeaders: map[string]string{
+				"RateLimit-Limit":     "2",
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "60",
+				"RateLimit-Policy":    "2;w=60",
+				"Retry-After":         "60",
+			},
+		},
+		{
+			name: "ok, subject is limited across ip addresses",
+			whenRequests: []rateLimitRequest{
+				{claims: jwt.MapClaims{"sub": "joe"}, ip: "192.0.2.1"},
+				{claims: jwt.MapClaims{"sub": "joe"}, ip: "192.0.2.2"},
+			},
+			expectAllowed: 2,
+		},
+		{
+			name:          "ok, client_id key for tokens without subject",
+			whenRequests:  []rateLimitRequest{{claims: jwt.MapClaims{"client_id": "svc"}}},
+			expectAllowed: 2,
+		},
+		{
+			name: "ok, tier limit",
+			whenRequests: []rateLimitRequest{
+				{claims: jwt.MapClaims{"sub": "joe", "subscription": map[string]interface{}{"tier": "pro"}, "scope": "bulk"}},
+			},
+			expectAllowed: 5,
+			expectHeaders: map[string]string{"RateLimit-Limit": "5", "RateLimit-Policy": "5;w=60"},
+		},
+		{
+			name:          "ok, unknown tier uses default limit",
+			whenRequests:  []rateLimitRequest{{claims: jwt.MapClaims{"sub": "joe", "subscription": map[string]interface{}{"tier": "free"}}}},
+			expectAllowed: 2,
+		},
+		{
+			name:          "ok, most generous scope limit",
+			whenRequests:  []rateLimitRequest{{claims: jwt.MapClaims{"sub": "joe", "scope": "read bulk batch"}}},
+			expectAllowed: 3,
+			expectHeaders: map[string]string{"RateLimit-Limit": "3", "RateLimit-Policy": "3;w=1", "Retry-After": "1"},
+		},
+		{
+			name:          "ok, principal subject without token",
+			whenRequests:  []rateLimitRequest{{principal: &Principal{Scheme: AuthSchemeAPIKey, Subject: "svc"}, ip: "192.0.2.1"}},
+			expectAllowed: 2,
+		},
+		{
+			name: "ok, client ip without token",
+			whenRequests: []rateLimitRequest{
+				{ip: "192.0.2.1", principal: &Principal{Anonymous: true}},
+				{ip: "192.0.2.1"},
+			},
+			expectAllowed: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mw := RateLimitWithConfig(config)
+
+			allowed := 0
+			var rec *httptest.ResponseRecorder
+			var err error
+			for i := 0; i < 10; i++ {
+				rec, err = serveRateLimit(mw, tc.whenRequests[i%len(tc.whenRequests)])
+				if err == nil {
+					allowed++
+					continue
+				}
+				assert.Equal(t, ErrRateLimitExceeded, err)
+			}
+
+			assert.Equal(t, tc.expectAllowed, allowed)
+			for k, v := range tc.expectHeaders {
+				assert.Equal(t, v, rec.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestRateLimitConfig_ToMiddleware_separateKeys(t *testing.T) {
+	mw := RateLimitBySubject(1, time.Minute)
+
+	_, err := serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"sub": "joe"}})
+	assert.NoError(t, err)
+	_, err = serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"sub": "jane"}})
+	assert.NoError(t, err)
+	_, err = serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"client_id": "joe"}})
+	assert.NoError(t, err)
+	rec, err := serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"sub": "joe"}})
+	assert.Equal(t, ErrRateLimitExceeded, err)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store unavailable")
+}
+
+func TestRateLimitConfig_ErrorHandler(t *testing.T) {
+	var handlerErrs []error
+	errorHandler := func(c *echo.Context, err error) error {
+		handlerErrs = append(handlerErrs, err)
+		return echo.ErrServiceUnavailable
+	}
+	mw := RateLimitWithConfig(RateLimitConfig{Limit: RateLimit{Limit: 1, Window: time.Minute}, ErrorHandler: errorHandler})
+
+	_, err := serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"sub": "joe"}})
+	assert.NoError(t, err)
+	_, err = serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"sub": "joe"}})
+	assert.Equal(t, echo.ErrServiceUnavailable, err)
+
+	mw = RateLimitWithConfig(RateLimitConfig{Limit: RateLimit{Limit: 1, Window: time.Minute}, Store: failingRateLimitStore{}})
+	_, err = serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"sub": "joe"}})
+	assert.EqualError(t, err, "store unavailable")
+
+	mw = RateLimitWithConfig(RateLimitConfig{
+		Limit:        RateLimit{Limit: 1, Window: time.Minute},
+		Store:        failingRateLimitStore{},
+		ErrorHandler: errorHandler,
+	})
+	_, err = serveRateLimit(mw, rateLimitRequest{claims: jwt.MapClaims{"sub": "joe"}})
+	assert.Equal(t, echo.ErrServiceUnavailable, err)
+
+	assert.Len(t, handlerErrs, 2)
+	assert.Equal(t, ErrRateLimitExceeded, handlerErrs[0])
+	assert.EqualError(t, handlerErrs[1], "store unavailable")
+}
+
+func TestRateLimitMemoryStore_Take(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewRateLimitMemoryStore()
+	s.timeNow = func() time.Time { return now }
+	limit := RateLimit{Limit: 2, Window: 10 * time.Second}
+
+	res, err := s.Take(context.Background(), "a", limit)
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 1, Reset: 10 * time.Second}, res)
+
+	now = now.Add(4 * time.Second)
+	res, _ = s.Take(context.Background(), "a", limit)
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 0, Reset: 6 * time.Second}, res)
+	res, _ = s.Take(context.Background(), "a", limit)
+	assert.Equal(t, RateLimitResult{Allowed: false, Remaining: 0, Reset: 6 * time.Second}, res)
+
+	res, _ = s.Take(context.Background(), "b", limit)
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 1, Reset: 10 * time.Second}, res)
+
+	now = now.Add(6 * time.Second)
+	res, _ = s.Take(context.Background(), "a", limit)
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 1, Reset: 10 * time.Second}, res)
+
+	// ended windows are removed
+	now = now.Add(2 * time.Minute)
+	_, _ = s.Take(context.Background(), "c", limit)
+	assert.Len(t, s.windows, 1)
+}
+
+func TestRateLimitConfig_ToMiddleware_error(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		whenConfig  RateLimitConfig
+		expectError string
+	}{
+		{
+			name:        "nok, missing limit",
+			whenConfig:  RateLimitConfig{},
+			expectError: "jwt rate limit middleware limit: limit must be positive",
+		},
+		{
+			name:        "nok, missing window",
+			whenConfig:  RateLimitConfig{Limit: RateLimit{Limit: 1}},
+			expectError: "jwt rate limit middleware limit: window must be positive",
+		},
+		{
+			name: "nok, invalid tier limit",
+			whenConfig: RateLimitConfig{
+				Limit: RateLimit{Limit: 1, Window: time.Second},
+				Tiers: map[string]RateLimit{"pro": {Window: time.Second}},
+			},
+			expectError: "jwt rate limit middleware tier pro limit: limit must be positive",
+		},
+		{
+			name: "nok, invalid scope limit",
+			whenConfig: RateLimitConfig{
+				Limit:       RateLimit{Limit: 1, Window: time.Second},
+				ScopeLimits: map[string]RateLimit{"bulk": {Limit: 1}},
+			},
+			expectError: "jwt rate limit middleware scope bulk limit: window must be positive",
+		},
+		{
+			name:        "nok, invalid key claim",
+			whenConfig:  RateLimitConfig{Limit: RateLimit{Limit: 1, Window: time.Second}, KeyClaims: []string{"a..b"}},
+			expectError: `jwt rate limit middleware key claim: invalid claim path "a..b": empty claim name`,
+		},
+		{
+			name:        "nok, invalid tier claim",
+			whenConfig:  RateLimitConfig{Limit: RateLimit{Limit: 1, Window: time.Second}, TierClaim: "a."},
+			expectError: `jwt rate limit middleware tier claim: invalid claim path "a.": empty claim name`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.whenConfig.ToMiddleware()
+			assert.EqualError(t, err, tc.expectError)
+		})
+	}
+
+	assert.Panics(t, func() { RateLimitBySubject(0, time.Second) })
+}
@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+// RoutePolicy defines overrides of Config applied by the JWT middleware to requests of a single route. This allows one
+// middleware instance registered with `e.Use` to validate tokens differently for some routes.
+type RoutePolicy struct {
+	// Audience is list of accepted `aud` claim values for the route. Token must contain at least one of them.
+	// Replaces audience checked by Config.ParserOptions or IssuerProfile.Audience. With TenantResolver or custom
+	// ParseTokenFunc audience is checked in addition to audience checked by the parser.
+	// Optional. When empty audience of the base Config is used.
+	Audience []string
+
+	// RequiredClaims are claims token must contain with given values. When token claim is an array, value must be one
+	// of the array elements.
+	// Optional.
+	RequiredClaims map[string]interface{}
+
+	// Optional enables optional authentication for the route. See Config.Optional.
+	// Optional. Default value false.
+	Optional bool
+}
+
+// RoutePolicies is map of route policies by route name (echo.RouteInfo.Name). Echo names routes without explicit name
+// as "<METHOD>:<path>", for example "GET:/users/:id".
+type RoutePolicies map[string]RoutePolicy
+
+// routePolicy is RoutePolicy prepared for the middleware
+type routePolicy struct {
+	parseToken func(c *echo.Context, auth string) (interface{}, error)
+	optional   bool
+}
+
+// newRoutePolicies prepares route policies on top of config that has defaults already applied. isDefaultParser tells
+// if config.ParseTokenFunc is implementation of this library and not user-defined function.
+func newRoutePolicies(config Config, isDefaultParser bool) (map[string]routePolicy, error) {
+	result := make(map[string]routePolicy, len(config.RoutePolicies))
+	for route, policy := range config.RoutePolicies {
+		p, err := config.newRoutePolicy(policy, isDefaultParser)
+		if err != nil {
+			return nil, fmt.Errorf("jwt middleware route policy %v: %w", route, err)
+		}
+		result[route] = p
+	}
+	return result, nil
+}
+
+func (config Config) newRoutePolicy(policy RoutePolicy, isDefaultParser bool) (routePolicy, error) {
+	parseToken := config.ParseTokenFunc
+	checkAudience := false
+	if len(policy.Audience) > 0 {
+		switch {
+		case isDefaultParser && len(config.Issuers) > 0:
+			profiles := slices.Clone(config.Issuers)
+			for i := range profiles {
+				profiles[i].Audience = policy.Audience
+			}
+			issuers, err := newIssuerParsers(profiles)
+			if err != nil {
+				return routePolicy{}, err
+			}
+			parseToken = issuers.parseToken
+		case isDefaultParser && config.TenantResolver == nil:
+			// later audience option replaces audience set by earlier options
+			config.ParserOptions = append(slices.Clone(config.ParserOptions), jwt.WithAudience(policy.Audience...))
+			parseToken = config.defaultParseTokenFunc
+		default:
+			checkAudience = true
+		}
+	}
+
+	required := make(map[string]interface{}, len(policy.RequiredClaims))
+	for name, value := range policy.RequiredClaims {
+		// normalize value to the types claims have after JSON decoding, i.e. int to float64
+		b, err := json.Marshal(value)
+		if err != nil {
+			return routePolicy{}, fmt.Errorf("invalid required claim %v value: %w", name, err)
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return routePolicy{}, fmt.Errorf("invalid required claim %v value: %w", name, err)
+		}
+		required[name] = v
+	}
+
+	if checkAudience || len(required) > 0 {
+		parseToken = policy.checkClaims(parseToken, checkAudience, required)
+	}
+	return routePolicy{parseToken: parseToken, optional: policy.Optional}, nil
+}
+
+// routeName returns name of the route matched for the request. Echo does not store name generated for routes
+// registered without explicit name in the context, so the name is generated the same way as echo.Route.ToRouteInfo
+// does.
+func routeName(c *echo.Context) string {
+	ri := c.RouteInfo()
+	if ri.Name != "" {
+		return ri.Name
+	}
+	return ri.Method + ":" + ri.Path
+}
+
+// checkClaims wraps parseToken to check audience and required claims of the parsed token.
+//
+// error returns TokenError.
+func (policy RoutePolicy) checkClaims(
+	parseToken func(c *echo.Context, auth string) (interface{}, error),
+	checkAudience bool,
+	required map[string]interface{},
+) func(c *echo.Context, auth string) (interface{}, error) {
+	return func(c *echo.Context, auth string) (interface{}, error) {
+		result, err := parseToken(c, auth)
+		if err != nil {
+			return nil, err
+		}
+		token, ok := result.(*jwt.Token)
+		if !ok {
+			return nil, &TokenError{Err: fmt.Errorf("jwt route policy can not check claims of token type %T", result)}
+		}
+		claims, err := claimsToMap(token.Claims)
+		if err != nil {
+			return nil, &TokenError{Token: token, Err: err}
+		}
+		if checkAudience && !slices.ContainsFunc(claimStrings(claims, "aud"), func(aud string) bool {
+			return slices.Contains(policy.Audience, aud)
+		}) {
+			return nil, &TokenError{Token: token, Err: jwt.ErrTokenInvalidAudience}
+		}
+		for name, value := range required {
+			if !claimMatches(claims[name], value) {
+				return nil, &TokenError{Token: token, Err: fmt.Errorf("jwt claim %v does not match required value", name)}
+			}
+		}
+		return token, nil
+	}
+}
+
+// claimMatches checks if claim equals value or claim is an array containing value.
+func claimMatches(claim interface{}, value interface{}) bool {
+	if claim == nil {
+		return false
+	}
+	if reflect.DeepEqual(claim, value) {
+		return true
+	}
+	if values, ok := claim.([]interface{}); ok {
+		return slices.ContainsFunc(values, func(v interface{}) bool { return reflect.DeepEqual(v, value) })
+	}
+	return false
+}
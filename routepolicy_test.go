@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRoutePolicyServer(t *testing.T, config Config) *echo.Echo {
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(mw)
+	handler := func(c *echo.Context) error {
+		if c.Get("user") == nil {
+			return c.String(http.StatusOK, "anonymous")
+		}
+		return c.String(http.StatusOK, "authenticated")
+	}
+	e.GET("/default", handler)
+	e.GET("/public", handler)
+	e.GET("/admin", handler)
+	if _, err := e.AddRoute(echo.Route{Method: http.MethodGet, Path: "/orgs/:org", Name: "org", Handler: handler}); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func serveRoutePolicy(e *echo.Echo, path string, token *jwttest.TokenBuilder, t *testing.T) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != nil {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token.MustSign(t))
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConfig_RoutePolicies(t *testing.T) {
+	hsKey := jwttest.Key("HS256")
+	policies := RoutePolicies{
+		"GET:/public": {Optional: true},
+		"GET:/admin":  {Audience: []string{"admin"}, RequiredClaims: map[string]interface{}{"roles": "admin"}},
+		"org":         {RequiredClaims: map[string]interface{}{"org_id": 42, "verified": true}},
+	}
+
+	var testCases = []struct {
+		name         string
+		givenConfig  Config
+		whenPath     string
+		whenToken    *jwttest.TokenBuilder
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name:         "ok, route without policy",
+			whenPath:     "/default",
+			whenToken:    jwttest.NewToken("HS256"),
+			expectStatus: http.StatusOK,
+			expectBody:   "authenticated",
+		},
+		{
+			name:         "nok, route without policy requires token",
+			whenPath:     "/default",
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "nok, route without policy uses base audience",
+			whenPath:     "/default",
+			whenToken:    jwttest.NewToken("HS256").Audience("admin"),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "ok, optional route without token",
+			whenPath:     "/public",
+			expectStatus: http.StatusOK,
+			expectBody:   "anonymous",
+		},
+		{
+			name:         "ok, optional route with token",
+			whenPath:     "/public",
+			whenToken:    jwttest.NewToken("HS256"),
+			expectStatus: http.StatusOK,
+			expectBody:   "authenticated",
+		},
+		{
+			name:         "nok, optional route with invalid token",
+			whenPath:     "/public",
+			whenToken:    jwttest.NewToken("HS256").Expired(),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "ok, route audience replaces base audience",
+			whenPath:     "/admin",
+			whenToken:    jwttest.NewToken("HS256").Audience("admin").Claim("roles", []string{"user", "admin"}),
+			expectStatus: http.StatusOK,
+			expectBody:   "authenticated",
+		},
+		{
+			name:         "nok, route audience",
+			whenPath:     "/admin",
+			whenToken:    jwttest.NewToken("HS256").Claim("roles", "admin"),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "nok, route required claim",
+			whenPath:     "/admin",
+			whenToken:    jwttest.NewToken("HS256").Audience("admin").Claim("roles", []string{"user"}),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "ok, named route required claims",
+			whenPath:     "/orgs/42",
+			whenToken:    jwttest.NewToken("HS256").Claim("org_id", 42).Claim("verified", true),
+			expectStatus: http.StatusOK,
+			expectBody:   "authenticated",
+		},
+		{
+			name:         "nok, named route required claim value",
+			whenPath:     "/orgs/42",
+			whenToken:    jwttest.NewToken("HS256").Claim("org_id", "42").Claim("verified", true),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "nok, named route required claim missing",
+			whenPath:     "/orgs/42",
+			whenToken:    jwttest.NewToken("HS256").Claim("org_id", 42),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "ok, issuers route audience",
+			givenConfig: Config{
+				Issuers: []IssuerProfile{{
+					Issuer:     jwttest.DefaultIssuer,
+					SigningKey: hsKey.PublicKey,
+					Audience:   []string{jwttest.DefaultAudience},
+				}},
+			},
+			whenPath:     "/admin",
+			whenToken:    jwttest.NewToken("HS256").Audience("admin").Claim("roles", "admin"),
+			expectStatus: http.StatusOK,
+			expectBody:   "authenticated",
+		},
+		{
+			name: "nok, issuers route audience",
+			givenConfig: Config{
+				Issuers: []IssuerProfile{{
+					Issuer:     jwttest.DefaultIssuer,
+					SigningKey: hsKey.PublicKey,
+					Audience:   []string{jwttest.DefaultAudience},
+				}},
+			},
+			whenPath:     "/admin",
+			whenToken:    jwttest.NewToken("HS256").Claim("roles", "admin"),
+			expectStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "ok, custom parser route audience",
+			givenConfig: Config{
+				ParseTokenFunc: func(c *echo.Context, auth string) (interface{}, error) {
+					return jwt.Parse(auth, func(token *jwt.Token) (interface{}, error) { return hsKey.PublicKey, nil })
+				},
+			},
+			whenPath:     "/admin",
+			whenToken:    jwttest.NewToken("HS256").Audience("admin").Claim("roles", "admin"),
+			expectStatus: http.StatusOK,
+			expectBody:   "authenticated",
+		},
+		{
+			name: "nok, custom parser route audience",
+			givenConfig: Config{
+				ParseTokenFunc: func(c *echo.Context, auth string) (interface{}, error) {
+					return jwt.Parse(auth, func(token *jwt.Token) (interface{}, error) { return hsKey.PublicKey, nil })
+				},
+			},
+			whenPath:     "/admin",
+			whenToken:    jwttest.NewToken("HS256").Claim("roles", "admin"),
+			expectStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.givenConfig
+			if config.Issuers == nil && config.ParseTokenFunc == nil {
+				config.SigningKey = hsKey.PublicKey
+				config.ParserOptions = []jwt.ParserOption{jwt.WithAudience(jwttest.DefaultAudience)}
+			}
+			config.RoutePolicies = policies
+			e := newRoutePolicyServer(t, config)
+
+			rec := serveRoutePolicy(e, tc.whenPath, tc.whenToken, t)
+			assert.Equal(t, tc.expectStatus, rec.Code)
+			if tc.expectBody != "" {
+				assert.Equal(t, tc.expectBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestConfig_RoutePolicies_errorKind(t *testing.T) {
+	mw, err := Config{
+		SigningKey:    jwttest.Key("HS256").PublicKey,
+		RoutePolicies: RoutePolicies{"GET:/": {RequiredClaims: map[string]interface{}{"roles": "admin"}}},
+		ParseTokenFunc: func(c *echo.Context, auth string) (interface{}, error) {
+			return jwt.Parse(auth, func(token *jwt.Token) (interface{}, error) { return jwttest.Key("HS256").PublicKey, nil })
+		},
+	}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	var handlerErr error
+	e.GET("/", func(c *echo.Context) error { return nil }, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			handlerErr = mw(next)(c)
+			return handlerErr
+		}
+	})
+	serveRoutePolicy(e, "/", jwttest.NewToken("HS256"), t)
+
+	assert.EqualError(t, handlerErr, "code=401, message=invalid or expired jwt, err=jwt claim roles does not match required value")
+	assert.Equal(t, ErrorKindInvalid, ErrorKindOf(handlerErr))
+}
+
+func TestConfig_RoutePolicies_invalidConfig(t *testing.T) {
+	_, err := Config{
+		SigningKey:    []byte("secret"),
+		RoutePolicies: RoutePolicies{"GET:/": {RequiredClaims: map[string]interface{}{"fn": func() {}}}},
+	}.ToMiddleware()
+	assert.EqualError(t, err, "jwt middleware route policy GET:/: invalid required claim fn value: json: unsupported type: func()")
+}
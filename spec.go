@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigSpec is serializable subset of Config that can be loaded from JSON or YAML file or from environment variables.
+// Use ToConfig or ToMiddleware to create the middleware from it.
+//
+// Exactly one key source must be set: Keys, KeyFile or JWKSURL.
+type ConfigSpec struct {
+	// TokenLookup is same as Config.TokenLookup.
+	// Optional. Default value "header:Authorization:Bearer ".
+	TokenLookup string `json:"token_lookup,omitempty" yaml:"token_lookup,omitempty"`
+
+	// Algorithms is list of allowed token signing algorithms.
+	// Optional. Default value [HS256] for inline keys, for KeyFile and JWKSURL algorithm is restricted only by key type
+	// and JWK `alg` parameter.
+	Algorithms []string `json:"algorithms,omitempty" yaml:"algorithms,omitempty"`
+
+	// Keys are inline token verification keys.
+	Keys []KeySpec `json:"keys,omitempty" yaml:"keys,omitempty"`
+
+	// KeyFile is path to the file with verification keys. File is reloaded when it changes. See FileKeyProvider.
+	KeyFile string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+
+	// JWKSURL is URL of JSON Web Key Set. Key set is refreshed periodically. See JWKSKeyProvider.
+	JWKSURL string `json:"jwks_url,omitempty" yaml:"jwks_url,omitempty"`
+
+	// Issuer is required `iss` claim value.
+	// Optional. When empty `iss` claim is not checked.
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+
+	// Audience is list of accepted `aud` claim values. Token must contain at least one of them.
+	// Optional. When empty `aud` claim is not checked.
+	Audience []string `json:"audience,omitempty" yaml:"audience,omitempty"`
+
+	// Leeway is allowed clock skew when time based claims are validated, in time.ParseDuration format, for example "30s".
+	// Optional.
+	Leeway string `json:"leeway,omitempty" yaml:"leeway,omitempty"`
+
+	// ContextKey is same as Config.ContextKey.
+	// Optional. Default value "user".
+	ContextKey string `json:"context_key,omitempty" yaml:"context_key,omitempty"`
+}
+
+// KeySpec is inline token verification key of ConfigSpec. Exactly one of Secret and PublicKey must be set.
+type KeySpec struct {
+	// KeyID is `kid` header value of tokens verified with the key.
+	// Required when there is more than one key.
+	KeyID string `json:"kid,omitempty" yaml:"kid,omitempty"`
+
+	// Algorithm is token signing algorithm the key is used with.
+	// Optional. Defaults to the only ConfigSpec.Algorithms entry or HS256 when Algorithms is empty.
+	Algorithm string `json:"alg,omitempty" yaml:"alg,omitempty"`
+
+	// Secret is HMAC secret for HS* algorithms.
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+
+	// PublicKey is PEM encoded public key or certificate or public key in JWK format.
+	PublicKey string `json:"public_key,omitempty" yaml:"public_key,omitempty"`
+}
+
+// SpecFieldError is ConfigSpec validation error for a single field. Field is name of the field as in JSON and YAML, for
+// example "keys[1].alg".
+type SpecFieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *SpecFieldError) Error() string {
+	return fmt.Sprintf("jwt config spec field %v: %v", e.Field, e.Err)
+}
+
+func (e *SpecFieldError) Unwrap() error { return e.Err }
+
+// ParseConfigSpecJSON parses ConfigSpec from JSON. Unknown fields are rejected.
+func ParseConfigSpecJSON(data []byte) (ConfigSpec, error) {
+	var spec ConfigSpec
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return ConfigSpec{}, fmt.Errorf("jwt config spec: invalid JSON: %w", err)
+	}
+	return spec, nil
+}
+
+// ParseConfigSpecYAML parses ConfigSpec from YAML. Unknown fields are rejected.
+func ParseConfigSpecYAML(data []byte) (ConfigSpec, error) {
+	var spec ConfigSpec
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil {
+		return ConfigSpec{}, fmt.Errorf("jwt config spec: invalid YAML: %w", err)
+	}
+	return spec, nil
+}
+
+// LoadConfigSpecFile loads ConfigSpec from JSON (`.json` extension) or YAML (`.yaml` or `.yml` extension) file.
+func LoadConfigSpecFile(path string) (ConfigSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigSpec{}, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ParseConfigSpecJSON(data)
+	case ".yaml", ".yml":
+		return ParseConfigSpecYAML(data)
+	}
+	return ConfigSpec{}, fmt.Errorf("jwt config spec: unsupported file extension: %v", path)
+}
+
+// ConfigSpecFromEnv reads ConfigSpec from environment variables named by prefix and upper case field name, for
+// example with prefix "JWT" variables are JWT_TOKEN_LOOKUP, JWT_ALGORITHMS, JWT_KEY_FILE, JWT_JWKS_URL, JWT_ISSUER,
+// JWT_AUDIENCE, JWT_LEEWAY and JWT_CONTEXT_KEY. List values (algorithms, audience) are comma separated.
+//
+// Single inline key is read from JWT_SECRET or JWT_PUBLIC_KEY with optional JWT_KEY_ID.
+func ConfigSpecFromEnv(prefix string) ConfigSpec {
+	env := func(name string) string {
+		return strings.TrimSpace(os.Getenv(prefix + "_" + name))
+	}
+	list := func(name string) []string {
+		var result []string
+		for _, v := range strings.Split(env(name), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+		return result
+	}
+
+	spec := ConfigSpec{
+		TokenLookup: os.Getenv(prefix + "_TOKEN_LOOKUP"), // not trimmed, header prefix ends with space
+		Algorithms:  list("ALGORITHMS"),
+		KeyFile:     env("KEY_FILE"),
+		JWKSURL:     env("JWKS_URL"),
+		Issuer:      env("ISSUER"),
+		Audience:    list("AUDIENCE"),
+		Leeway:      env("LEEWAY"),
+		ContextKey:  env("CONTEXT_KEY"),
+	}
+	secret, publicKey := os.Getenv(prefix+"_SECRET"), env("PUBLIC_KEY")
+	if secret != "" || publicKey != "" {
+		spec.Keys = []KeySpec{{KeyID: env("KEY_ID"), Secret: secret, PublicKey: publicKey}}
+	}
+	return spec
+}
+
+// Validate checks the spec without loading keys from KeyFile and JWKSURL. Returned error joins SpecFieldError for
+// every invalid field.
+func (spec ConfigSpec) Validate() error {
+	_, err := spec.inlineKeys()
+	return err
+}
+
+// ToConfig validates the spec and converts it to Config. Keys from KeyFile and JWKSURL are loaded once and are not
+// watched for changes, keys from JWKSURL are still refreshed when token with unknown `kid` is verified. Use ToMiddleware
+// to watch keys for changes.
+func (spec ConfigSpec) ToConfig(ctx context.Context) (Config, error) {
+	config, _, err := spec.toConfig(ctx)
+	return config, err
+}
+
+// ToMiddleware validates the spec and converts it to middleware. Keys from KeyFile and JWKSURL are watched for changes
+// until ctx is cancelled.
+func (spec ConfigSpec) ToMiddleware(ctx context.Context) (echo.MiddlewareFunc, error) {
+	config, watch, err := spec.toConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		return nil, err
+	}
+	if watch != nil {
+		go watch(ctx)
+	}
+	return mw, nil
+}
+
+// toConfig converts the spec to Config. Returned watch function watches keys from KeyFile or JWKSURL for changes until
+// context is cancelled and is nil when keys are inline.
+func (spec ConfigSpec) toConfig(ctx context.Context) (Config, func(ctx context.Context), error) {
+	keys, err := spec.inlineKeys()
+	if err != nil {
+		return Config{}, nil, err
+	}
+	leeway, _ := spec.leeway()
+
+	config := Config{
+		TokenLookup: spec.TokenLookup,
+		ContextKey:  spec.ContextKey,
+	}
+	if spec.Issuer != "" {
+		config.ParserOptions = append(config.ParserOptions, jwt.WithIssuer(spec.Issuer))
+	}
+	if len(spec.Audience) > 0 {
+		config.ParserOptions = append(config.ParserOptions, jwt.WithAudience(spec.Audience...))
+	}
+	if leeway > 0 {
+		config.ParserOptions = append(config.ParserOptions, jwt.WithLeeway(leeway))
+	}
+
+	var watch func(ctx context.Context)
+	switch {
+	case len(keys) == 1 && keys[0].KeyID == "":
+		config.SigningKey = keys[0].Key
+		config.SigningMethod = keys[0].Algorithm
+	case len(keys) > 0:
+		config.KeySet = make(KeySet, len(keys))
+		for _, k := range keys {
+			config.KeySet[k.KeyID] = VerificationKey{Key: k.Key, Algorithm: k.Algorithm}
+		}
+	case spec.KeyFile != "":
+		provider, err := NewFileKeyProvider(FileKeyProviderConfig{Path: spec.KeyFile})
+		if err != nil {
+			return Config{}, nil, &SpecFieldError{Field: "key_file", Err: err}
+		}
+		watch = provider.Watch
+		config.KeyFunc = allowedAlgorithmsKeyFunc(spec.Algorithms, provider.KeyFunc)
+	case spec.JWKSURL != "":
+		provider, err := NewJWKSKeyProvider(ctx, JWKSKeyProviderConfig{URL: spec.JWKSURL})
+		if err != nil {
+			return Config{}, nil, &SpecFieldError{Field: "jwks_url", Err: err}
+		}
+		watch = provider.Watch
+		config.KeyFunc = allowedAlgorithmsKeyFunc(spec.Algorithms, provider.KeyFunc)
+	}
+	return config, watch, nil
+}
+
+// inlineKeys validates the spec and parses inline keys. Key algorithm defaults are applied to returned keys.
+func (spec ConfigSpec) inlineKeys() ([]JSONWebKey, error) {
+	var errs []error
+	fieldErr := func(field string, format string, args ...interface{}) {
+		errs = append(errs, &SpecFieldError{Field: field, Err: fmt.Errorf(format, args...)})
+	}
+
+	if _, err := createExtractors(spec.TokenLookup); err != nil {
+		errs = append(errs, &SpecFieldError{Field: "token_lookup", Err: err})
+	}
+	for i, alg := range spec.Algorithms {
+		if m := jwt.GetSigningMethod(alg); m == nil || m == jwt.SigningMethodNone {
+			fieldErr(fmt.Sprintf("algorithms[%d]", i), "unsupported signing algorithm %q", alg)
+		}
+	}
+
+	var sources []string
+	if len(spec.Keys) > 0 {
+		sources = append(sources, "keys")
+	}
+	if spec.KeyFile != "" {
+		sources = append(sources, "key_file")
+	}
+	if spec.JWKSURL != "" {
+		sources = append(sources, "jwks_url")
+	}
+	switch {
+	case len(sources) == 0:
+		fieldErr("keys", "one of keys, key_file or jwks_url is required")
+	case len(sources) > 1:
+		fieldErr(sources[1], "can not be used together with %v", sources[0])
+	}
+
+	if spec.JWKSURL != "" {
+		if u, err := url.Parse(spec.JWKSURL); err != nil {
+			errs = append(errs, &SpecFieldError{Field: "jwks_url", Err: err})
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fieldErr("jwks_url", "must be absolute http or https URL")
+		}
+	}
+	for i, aud := range spec.Audience {
+		if aud == "" {
+			fieldErr(fmt.Sprintf("audience[%d]", i), "must not be empty")
+		}
+	}
+	if _, err := spec.leeway(); err != nil {
+		errs = append(errs, &SpecFieldError{Field: "leeway", Err: err})
+	}
+
+	keys := make([]JSONWebKey, 0, len(spec.Keys))
+	kids := map[string]bool{}
+	for i, k := range spec.Keys {
+		field := fmt.Sprintf("keys[%d]", i)
+		key, err := spec.parseKey(k)
+		if err != nil {
+			errs = append(errs, &SpecFieldError{Field: field + err.Field, Err: err.Err})
+			continue
+		}
+		if len(spec.Keys) > 1 && k.KeyID == "" {
+			fieldErr(field+".kid", "is required when there is more than one key")
+		} else if kids[k.KeyID] {
+			fieldErr(field+".kid", "duplicate key id %q", k.KeyID)
+		}
+		kids[k.KeyID] = true
+		keys = append(keys, key)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return keys, nil
+}
+
+// parseKey parses inline key. Returned error Field is relative to the key.
+func (spec ConfigSpec) parseKey(k KeySpec) (JSONWebKey, *SpecFieldError) {
+	alg := k.Algorithm
+	if alg == "" {
+		switch len(spec.Algorithms) {
+		case 0:
+			alg = AlgorithmHS256
+		case 1:
+			alg = spec.Algorithms[0]
+		default:
+			return JSONWebKey{}, &SpecFieldError{Field: ".alg", Err: errors.New("is required when there is more than one algorithm")}
+		}
+	}
+	if len(spec.Algorithms) > 0 && !slices.Contains(spec.Algorithms, alg) {
+		return JSONWebKey{}, &SpecFieldError{Field: ".alg", Err: fmt.Errorf("signing algorithm %q is not in algorithms", alg)}
+	}
+	if m := jwt.GetSigningMethod(alg); m == nil || m == jwt.SigningMethodNone {
+		return JSONWebKey{}, &SpecFieldError{Field: ".alg", Err: fmt.Errorf("unsupported signing algorithm %q", alg)}
+	}
+
+	var key interface{}
+	field := ".secret"
+	switch {
+	case k.Secret != "" && k.PublicKey != "":
+		return JSONWebKey{}, &SpecFieldError{Field: ".public_key", Err: errors.New("can not be used together with secret")}
+	case k.Secret != "":
+		key = []byte(k.Secret)
+	case k.PublicKey != "":
+		field = ".public_key"
+		pub, err := parsePublicKey([]byte(k.PublicKey))
+		if err != nil {
+			return JSONWebKey{}, &SpecFieldError{Field: field, Err: err}
+		}
+		key = pub
+	default:
+		return JSONWebKey{}, &SpecFieldError{Field: ".secret", Err: errors.New("one of secret or public_key is required")}
+	}
+	if err := validateSigningKey(alg, key); err != nil {
+		return JSONWebKey{}, &SpecFieldError{Field: field, Err: err}
+	}
+	return JSONWebKey{KeyID: k.KeyID, Algorithm: alg, Use: "sig", Key: key}, nil
+}
+
+func (spec ConfigSpec) leeway() (time.Duration, error) {
+	if spec.Leeway == "" {
+		return 0, nil
+	}
+	leeway, err := time.ParseDuration(spec.Leeway)
+	if err != nil {
+		return 0, err
+	}
+	if leeway < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return leeway, nil
+}
+
+// allowedAlgorithmsKeyFunc wraps keyFunc to reject tokens signed with algorithms not in algorithms. Empty algorithms
+// allows all algorithms.
+//
+// error returns TokenError.
+func allowedAlgorithmsKeyFunc(algorithms []string, keyFunc jwt.Keyfunc) jwt.Keyfunc {
+	if len(algorithms) == 0 {
+		return keyFunc
+	}
+	return func(token *jwt.Token) (interface{}, error) {
+		if !slices.Contains(algorithms, token.Method.Alg()) {
+			return nil, &TokenError{Token: token, Err: errUnexpectedSigningMethod(token)}
+		}
+		return keyFunc(token)
+	}
+}
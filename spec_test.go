@@ -0,0 +1,467 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo-jwt/v5/jwttest"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func publicKeyPEM(t *testing.T, key jwttest.KeyPair) string {
+	der, err := x509.MarshalPKIXPublicKey(key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestParseConfigSpecJSON(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		givenJSON   string
+		expect      ConfigSpec
+		expectError string
+	}{
+		{
+			name: "ok",
+			givenJSON: `{
+				"token_lookup": "header:Authorization:Bearer ,cookie:jwt",
+				"algorithms": ["RS256", "ES256"],
+				"jwks_url": "https://idp.example.com/.well-known/jwks.json",
+				"issuer": "https://idp.example.com",
+				"audience": ["api"],
+				"leeway": "30s",
+				"context_key": "token"
+			}`,
+			expect: ConfigSpec{
+				TokenLookup: "header:Authorization:Bearer ,cookie:jwt",
+				Algorithms:  []string{"RS256", "ES256"},
+				JWKSURL:     "https://idp.example.com/.well-known/jwks.json",
+				Issuer:      "https://idp.example.com",
+				Audience:    []string{"api"},
+				Leeway:      "30s",
+				ContextKey:  "token",
+			},
+		},
+		{
+			name:      "ok, inline keys",
+			givenJSON: `{"keys": [{"kid": "a", "alg": "HS256", "secret": "s3cret"}]}`,
+			expect:    ConfigSpec{Keys: []KeySpec{{KeyID: "a", Algorithm: "HS256", Secret: "s3cret"}}},
+		},
+		{
+			name:        "nok, unknown field",
+			givenJSON:   `{"jwks_uri": "https://idp.example.com"}`,
+			expectError: `jwt config spec: invalid JSON: json: unknown field "jwks_uri"`,
+		},
+		{
+			name:        "nok, invalid type",
+			givenJSON:   `{"audience": "api"}`,
+			expectError: "jwt config spec: invalid JSON: json: cannot unmarshal string into Go struct field ConfigSpec.audience of type []string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := ParseConfigSpecJSON([]byte(tc.givenJSON))
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, spec)
+		})
+	}
+}
+
+func TestParseConfigSpecYAML(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		givenYAML   string
+		expect      ConfigSpec
+		expectError string
+	}{
+		{
+			name: "ok",
+			givenYAML: `
+token_lookup: "header:Authorization:Bearer "
+algorithms: [ES256]
+keys:
+  - kid: a
+    public_key: |
+      {"kty": "EC"}
+issuer: https://idp.example.com
+audience:
+  - api
+leeway: 1m
+`,
+			expect: ConfigSpec{
+				TokenLookup: "header:Authorization:Bearer ",
+				Algorithms:  []string{"ES256"},
+				Keys:        []KeySpec{{KeyID: "a", PublicKey: "{\"kty\": \"EC\"}\n"}},
+				Issuer:      "https://idp.example.com",
+				Audience:    []string{"api"},
+				Leeway:      "1m",
+			},
+		},
+		{
+			name:        "nok, unknown field",
+			givenYAML:   "jwks_uri: https://idp.example.com\n",
+			expectError: "jwt config spec: invalid YAML: yaml: unmarshal errors:\n  line 1: field jwks_uri not found in type echojwt.ConfigSpec",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := ParseConfigSpecYAML([]byte(tc.givenYAML))
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, spec)
+		})
+	}
+}
+
+func TestLoadConfigSpecFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"spec.json": `{"issuer": "json"}`,
+		"spec.yaml": `issuer: yaml`,
+		"spec.yml":  `issuer: yml`,
+		"spec.toml": `issuer = "toml"`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var testCases = []struct {
+		name         string
+		whenFile     string
+		expectIssuer string
+		expectError  string
+	}{
+		{name: "ok, json", whenFile: "spec.json", expectIssuer: "json"},
+		{name: "ok, yaml", whenFile: "spec.yaml", expectIssuer: "yaml"},
+		{name: "ok, yml", whenFile: "spec.yml", expectIssuer: "yml"},
+		{
+			name:        "nok, unsupported extension",
+			whenFile:    "spec.toml",
+			expectError: "jwt config spec: unsupported file extension: " + filepath.Join(dir, "spec.toml"),
+		},
+		{
+			name:        "nok, missing file",
+			whenFile:    "missing.json",
+			expectError: "open " + filepath.Join(dir, "missing.json") + ": no such file or directory",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := LoadConfigSpecFile(filepath.Join(dir, tc.whenFile))
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectIssuer, spec.Issuer)
+		})
+	}
+}
+
+func TestConfigSpecFromEnv(t *testing.T) {
+	t.Setenv("APP_JWT_TOKEN_LOOKUP", "header:Authorization:Bearer ")
+	t.Setenv("APP_JWT_ALGORITHMS", "RS256, ES256")
+	t.Setenv("APP_JWT_ISSUER", "https://idp.example.com")
+	t.Setenv("APP_JWT_AUDIENCE", "api,web,")
+	t.Setenv("APP_JWT_LEEWAY", "5s")
+	t.Setenv("APP_JWT_CONTEXT_KEY", "token")
+	t.Setenv("APP_JWT_SECRET", "s3cret ")
+	t.Setenv("APP_JWT_KEY_ID", "a")
+	t.Setenv("JWT_ISSUER", "other")
+
+	assert.Equal(t, ConfigSpec{
+		TokenLookup: "header:Authorization:Bearer ",
+		Algorithms:  []string{"RS256", "ES256"},
+		Keys:        []KeySpec{{KeyID: "a", Secret: "s3cret "}},
+		Issuer:      "https://idp.example.com",
+		Audience:    []string{"api", "web"},
+		Leeway:      "5s",
+		ContextKey:  "token",
+	}, ConfigSpecFromEnv("APP_JWT"))
+
+	assert.Equal(t, ConfigSpec{Issuer: "other"}, ConfigSpecFromEnv("JWT"))
+}
+
+func TestConfigSpec_Validate(t *testing.T) {
+	esPEM := publicKeyPEM(t, jwttest.Key("ES256"))
+
+	var testCases = []struct {
+		name        string
+		givenSpec   ConfigSpec
+		expectError string
+	}{
+		{
+			name:      "ok, secret",
+			givenSpec: ConfigSpec{Keys: []KeySpec{{Secret: "s3cret"}}},
+		},
+		{
+			name:      "ok, public key",
+			givenSpec: ConfigSpec{Algorithms: []string{"ES256"}, Keys: []KeySpec{{PublicKey: esPEM}}},
+		},
+		{
+			name:      "ok, jwks url",
+			givenSpec: ConfigSpec{JWKSURL: "https://idp.example.com/jwks.json", Leeway: "10s"},
+		},
+		{
+			name:        "nok, no key source",
+			givenSpec:   ConfigSpec{},
+			expectError: "jwt config spec field keys: one of keys, key_file or jwks_url is required",
+		},
+		{
+			name:        "nok, multiple key sources",
+			givenSpec:   ConfigSpec{KeyFile: "keys.pem", JWKSURL: "https://idp.example.com/jwks.json"},
+			expectError: "jwt config spec field jwks_url: can not be used together with key_file",
+		},
+		{
+			name:        "nok, token lookup",
+			givenSpec:   ConfigSpec{TokenLookup: "header", KeyFile: "keys.pem"},
+			expectError: "jwt config spec field token_lookup: extractor source for lookup could not be split into needed parts: header",
+		},
+		{
+			name:        "nok, unknown algorithm",
+			givenSpec:   ConfigSpec{Algorithms: []string{"RS256", "XX256"}, KeyFile: "keys.pem"},
+			expectError: `jwt config spec field algorithms[1]: unsupported signing algorithm "XX256"`,
+		},
+		{
+			name:        "nok, none algorithm",
+			givenSpec:   ConfigSpec{Algorithms: []string{"none"}, KeyFile: "keys.pem"},
+			expectError: `jwt config spec field algorithms[0]: unsupported signing algorithm "none"`,
+		},
+		{
+			name:        "nok, jwks url scheme",
+			givenSpec:   ConfigSpec{JWKSURL: "file:///etc/jwks.json"},
+			expectError: "jwt config spec field jwks_url: must be absolute http or https URL",
+		},
+		{
+			name:        "nok, leeway",
+			givenSpec:   ConfigSpec{KeyFile: "keys.pem", Leeway: "10"},
+			expectError: `jwt config spec field leeway: time: missing unit in duration "10"`,
+		},
+		{
+			name:        "nok, negative leeway",
+			givenSpec:   ConfigSpec{KeyFile: "keys.pem", Leeway: "-1s"},
+			expectError: "jwt config spec field leeway: must not be negative",
+		},
+		{
+			name:        "nok, empty audience",
+			givenSpec:   ConfigSpec{KeyFile: "keys.pem", Audience: []string{"api", ""}},
+			expectError: "jwt config spec field audience[1]: must not be empty",
+		},
+		{
+			name:        "nok, key without secret or public key",
+			givenSpec:   ConfigSpec{Keys: []KeySpec{{KeyID: "a"}}},
+			expectError: "jwt config spec field keys[0].secret: one of secret or public_key is required",
+		},
+		{
+			name:        "nok, key with secret and public key",
+			givenSpec:   ConfigSpec{Keys: []KeySpec{{Secret: "s3cret", PublicKey: esPEM}}},
+			expectError: "jwt config spec field keys[0].public_key: can not be used together with secret",
+		},
+		{
+			name:        "nok, key algorithm not in algorithms",
+			givenSpec:   ConfigSpec{Algorithms: []string{"ES256"}, Keys: []KeySpec{{Algorithm: "HS256", Secret: "s3cret"}}},
+			expectError: `jwt config spec field keys[0].alg: signing algorithm "HS256" is not in algorithms`,
+		},
+		{
+			name:        "nok, key algorithm ambiguous",
+			givenSpec:   ConfigSpec{Algorithms: []string{"ES256", "RS256"}, Keys: []KeySpec{{PublicKey: esPEM}}},
+			expectError: "jwt config spec field keys[0].alg: is required when there is more than one algorithm",
+		},
+		{
+			name:        "nok, key type does not match algorithm",
+			givenSpec:   ConfigSpec{Keys: []KeySpec{{PublicKey: esPEM}}},
+			expectError: "jwt config spec field keys[0].public_key: jwt signing key type *ecdsa.PublicKey does not match signing method HS256, expected []byte",
+		},
+		{
+			name:        "nok, invalid public key",
+			givenSpec:   ConfigSpec{Algorithms: []string{"ES256"}, Keys: []KeySpec{{PublicKey: "{}"}}},
+			expectError: `jwt config spec field keys[0].public_key: jwt key: unsupported JWK key type: ""`,
+		},
+		{
+			name:        "nok, missing kid",
+			givenSpec:   ConfigSpec{Keys: []KeySpec{{KeyID: "a", Secret: "a"}, {Secret: "b"}}},
+			expectError: "jwt config spec field keys[1].kid: is required when there is more than one key",
+		},
+		{
+			name:        "nok, duplicate kid",
+			givenSpec:   ConfigSpec{Keys: []KeySpec{{KeyID: "a", Secret: "a"}, {KeyID: "a", Secret: "b"}}},
+			expectError: `jwt config spec field keys[1].kid: duplicate key id "a"`,
+		},
+		{
+			name:      "nok, multiple errors",
+			givenSpec: ConfigSpec{Algorithms: []string{"XX256"}, Leeway: "x"},
+			expectError: "jwt config spec field algorithms[0]: unsupported signing algorithm \"XX256\"\n" +
+				"jwt config spec field keys: one of keys, key_file or jwks_url is required\n" +
+				"jwt config spec field leeway: time: invalid duration \"x\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.givenSpec.Validate()
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				var fErr *SpecFieldError
+				assert.True(t, errors.As(err, &fErr))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfigSpec_ToMiddleware(t *testing.T) {
+	idp := jwttest.NewIdP(t, jwttest.Key("RS256"), jwttest.Key("ES256"))
+	hsKey := jwttest.Key("HS256")
+	esKey := jwttest.Key("ES256")
+
+	jwks, err := json.Marshal(jwttest.JWKS(esKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(keyFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		name        string
+		givenSpec   ConfigSpec
+		whenToken   *jwttest.TokenBuilder
+		expectError string
+	}{
+		{
+			name:      "ok, secret",
+			givenSpec: ConfigSpec{Keys: []KeySpec{{Secret: string(hsKey.PublicKey.([]byte))}}},
+			whenToken: jwttest.NewToken("HS256"),
+		},
+		{
+			name: "ok, key set",
+			givenSpec: ConfigSpec{Keys: []KeySpec{
+				{KeyID: hsKey.KeyID, Secret: string(hsKey.PublicKey.([]byte))},
+				{KeyID: esKey.KeyID, Algorithm: "ES256", PublicKey: publicKeyPEM(t, esKey)},
+			}},
+			whenToken: jwttest.NewToken("ES256"),
+		},
+		{
+			name:      "ok, key file",
+			givenSpec: ConfigSpec{KeyFile: keyFile},
+			whenToken: jwttest.NewToken("ES256"),
+		},
+		{
+			name:      "ok, jwks url",
+			givenSpec: ConfigSpec{JWKSURL: idp.JWKSURL(), Issuer: idp.Issuer(), Audience: []string{jwttest.DefaultAudience}},
+			whenToken: idp.NewToken("RS256"),
+		},
+		{
+			name:      "ok, leeway",
+			givenSpec: ConfigSpec{JWKSURL: idp.JWKSURL(), Leeway: "1m"},
+			whenToken: idp.NewToken("ES256").At(time.Now().Add(-time.Hour - 30*time.Second)),
+		},
+		{
+			name:        "nok, algorithm not allowed",
+			givenSpec:   ConfigSpec{JWKSURL: idp.JWKSURL(), Algorithms: []string{"ES256"}},
+			whenToken:   idp.NewToken("RS256"),
+			expectError: "code=401, message=invalid or expired jwt, err=token is unverifiable: error while executing keyfunc: unexpected jwt signing method=RS256",
+		},
+		{
+			name:        "nok, issuer",
+			givenSpec:   ConfigSpec{JWKSURL: idp.JWKSURL(), Issuer: "https://other.example.com"},
+			whenToken:   idp.NewToken("ES256"),
+			expectError: "code=401, message=invalid or expired jwt, err=token has invalid claims: token has invalid issuer",
+		},
+		{
+			name:        "nok, audience",
+			givenSpec:   ConfigSpec{JWKSURL: idp.JWKSURL(), Audience: []string{"other"}},
+			whenToken:   idp.NewToken("ES256"),
+			expectError: "code=401, message=invalid or expired jwt, err=token has invalid claims: token has invalid audience",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mw, err := tc.givenSpec.ToMiddleware(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = serveWithToken(mw, tc.whenToken.MustSign(t))
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfigSpec_ToConfig(t *testing.T) {
+	spec := ConfigSpec{
+		TokenLookup: "query:token",
+		ContextKey:  "token",
+		Keys:        []KeySpec{{Secret: string(jwttest.Key("HS256").PublicKey.([]byte))}},
+	}
+	config, err := spec.ToConfig(context.Background())
+	assert.NoError(t, err)
+
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwttest.NewToken("HS256").MustSign(t)
+	req := httptest.NewRequest(http.MethodGet, "/?token="+token, nil)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	err = mw(func(c *echo.Context) error {
+		assert.NotNil(t, c.Get("token"))
+		return nil
+	})(c)
+	assert.NoError(t, err)
+
+	_, err = ConfigSpec{KeyFile: filepath.Join(t.TempDir(), "missing.pem")}.ToConfig(context.Background())
+	var fErr *SpecFieldError
+	assert.True(t, errors.As(err, &fErr))
+	assert.Equal(t, "key_file", fErr.Field)
+}
+
+func TestConfigSpec_toConfig_watch(t *testing.T) {
+	_, watch, err := ConfigSpec{Keys: []KeySpec{{Secret: "secret"}}}.toConfig(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, watch)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, []byte(publicKeyPEM(t, jwttest.Key("ES256"))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, watch, err = ConfigSpec{KeyFile: path}.toConfig(context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, watch)
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+// StepUpConfig defines the config for step-up authentication middleware. Step-up middleware checks that token stored
+// in context by JWT middleware proves recent and strong enough user authentication (RFC 9470).
+//
+// Step-up middleware must be executed after JWT middleware, usually it is added to sensitive routes only.
+type StepUpConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// ContextKey is key where JWT middleware stored the token in context.
+	// Optional. Default value "user".
+	ContextKey string
+
+	// ACRValues is list of allowed `acr` (authentication context class reference) claim values. Token `acr` claim must
+	// be one of these values.
+	// Optional. When empty `acr` claim is not checked.
+	ACRValues []string
+
+	// RequiredAMR is list of `amr` (authentication methods references) claim values that must all be present in token
+	// `amr` claim. For example `[]string{"mfa"}` or `[]string{"pwd", "otp"}`.
+	// Optional. When empty `amr` claim is not checked.
+	RequiredAMR []string
+
+	// MaxAge is maximum allowed time since the user authenticated, checked against `auth_time` claim.
+	// Optional. When zero `auth_time` claim is not checked.
+	MaxAge time.Duration
+
+	// Leeway is allowed clock skew when `auth_time` claim is in the future.
+	// Optional. Default value 30 seconds.
+	Leeway time.Duration
+
+	// ErrorHandler defines a function which is executed when token does not satisfy step-up requirements. Error is
+	// ErrInsufficientUserAuthentication wrapping the reason, or ErrJWTMissing when there is no token in context.
+	// `WWW-Authenticate` challenge header is already set on the response for ErrInsufficientUserAuthentication.
+	// Optional. Default behaviour is to return the error.
+	ErrorHandler func(c *echo.Context, err error) error
+}
+
+// ErrInsufficientUserAuthentication denotes an error raised when token does not prove recent or strong enough user
+// authentication for the resource.
+var ErrInsufficientUserAuthentication = echo.NewHTTPError(http.StatusUnauthorized, "insufficient user authentication")
+
+// StepUp returns step-up authentication middleware requiring one of the given `acr` values and user authentication
+// no older than maxAge. maxAge of zero disables `auth_time` check.
+func StepUp(acrValues []string, maxAge time.Duration) echo.MiddlewareFunc {
+	return StepUpWithConfig(StepUpConfig{ACRValues: acrValues, MaxAge: maxAge})
+}
+
+// StepUpWithConfig returns step-up authentication middleware or panics if configuration is invalid.
+//
+// For token not satisfying the requirements, middleware returns "401 - Unauthorized" error with RFC 9470
+// `insufficient_user_authentication` challenge in `WWW-Authenticate` header.
+func StepUpWithConfig(config StepUpConfig) echo.MiddlewareFunc {
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		panic(err)
+	}
+	return mw
+}
+
+// ToMiddleware converts StepUpConfig to middleware or returns an error for invalid configuration
+func (config StepUpConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = "user"
+	}
+	if config.Leeway <= 0 {
+		config.Leeway = 30 * time.Second
+	}
+	if len(config.ACRValues) == 0 && len(config.RequiredAMR) == 0 && config.MaxAge <= 0 {
+		return nil, errors.New("jwt step-up middleware requires ACRValues, RequiredAMR or MaxAge")
+	}
+	challenge := config.challenge()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			token, err := tokenFromContext(c, config.ContextKey)
+			if err != nil {
+				err = ErrJWTMissing.Wrap(err)
+				if config.ErrorHandler != nil {
+					return config.ErrorHandler(c, err)
+				}
+				return err
+			}
+			err = config.check(token)
+			if err == nil {
+				return next(c)
+			}
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+			err = ErrInsufficientUserAuthentication.Wrap(err)
+			if config.ErrorHandler != nil {
+				return config.ErrorHandler(c, err)
+			}
+			return err
+		}
+	}, nil
+}
+
+func (config StepUpConfig) check(token *jwt.Token) error {
+	claims, err := claimsToMap(token.Claims)
+	if err != nil {
+		return err
+	}
+
+	if len(config.ACRValues) > 0 {
+		acr, _ := claimString(claims, "acr")
+		if !slices.Contains(config.ACRValues, acr) {
+			return fmt.Errorf("acr claim value is not allowed: %q", acr)
+		}
+	}
+	if len(config.RequiredAMR) > 0 {
+		amr := claimStrings(claims, "amr")
+		for _, method := range config.RequiredAMR {
+			if !slices.Contains(amr, method) {
+				return fmt.Errorf("amr claim is missing required method: %q", method)
+			}
+		}
+	}
+	if config.MaxAge > 0 {
+		authTime, ok := claimTime(claims, "auth_time")
+		if !ok {
+			return errors.New("auth_time claim is missing or invalid")
+		}
+		age := time.Since(authTime)
+		if age < -config.Leeway {
+			return errors.New("auth_time claim is in the future")
+		}
+		if age > config.MaxAge {
+			return errors.New("auth_time claim is older than allowed max age")
+		}
+	}
+	return nil
+}
+
+// challenge creates RFC 9470 `WWW-Authenticate` header value
+func (config StepUpConfig) challenge() string {
+	var sb strings.Builder
+	sb.WriteString(`Bearer error="insufficient_user_authentication"`)
+	sb.WriteString(`, error_description="A different authentication level is required"`)
+	if len(config.ACRValues) > 0 {
+		sb.WriteString(`, acr_values="` + strings.Join(config.ACRValues, " ") + `"`)
+	}
+	if config.MaxAge > 0 {
+		sb.WriteString(`, max_age="` + strconv.FormatInt(int64(math.Ceil(config.MaxAge.Seconds())), 10) + `"`)
+	}
+	return sb.String()
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepUpConfig_ToMiddleware(t *testing.T) {
+	var testCases = []struct {
+		name            string
+		givenConfig     StepUpConfig
+		whenClaims      jwt.Claims
+		whenNoToken     bool
+		expectError     string
+		expectChallenge string
+	}{
+		{
+			name:        "ok, acr is allowed",
+			givenConfig: StepUpConfig{ACRValues: []string{"urn:mfa", "urn:hwk"}},
+			whenClaims:  jwt.MapClaims{"acr": "urn:hwk"},
+		},
+		{
+			name:            "nok, acr is not allowed",
+			givenConfig:     StepUpConfig{ACRValues: []string{"urn:mfa", "urn:hwk"}},
+			whenClaims:      jwt.MapClaims{"acr": "urn:pwd"},
+			expectError:     `code=401, message=insufficient user authentication, err=acr claim value is not allowed: "urn:pwd"`,
+			expectChallenge: `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required", acr_values="urn:mfa urn:hwk"`,
+		},
+		{
+			name:        "ok, all required amr are present",
+			givenConfig: StepUpConfig{RequiredAMR: []string{"pwd", "otp"}},
+			whenClaims:  jwt.MapClaims{"amr": []interface{}{"otp", "pwd"}},
+		},
+		{
+			name:            "nok, required amr is missing",
+			givenConfig:     StepUpConfig{RequiredAMR: []string{"pwd", "otp"}},
+			whenClaims:      jwt.MapClaims{"amr": []interface{}{"pwd"}},
+			expectError:     `code=401, message=insufficient user authentication, err=amr claim is missing required method: "otp"`,
+			expectChallenge: `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required"`,
+		},
+		{
+			name:        "ok, auth_time is recent",
+			givenConfig: StepUpConfig{MaxAge: 5 * time.Minute},
+			whenClaims:  jwt.MapClaims{"auth_time": float64(time.Now().Add(-1 * time.Minute).Unix())},
+		},
+		{
+			name:            "nok, auth_time is too old",
+			givenConfig:     StepUpConfig{ACRValues: []string{"urn:mfa"}, MaxAge: 5 * time.Minute},
+			whenClaims:      jwt.MapClaims{"acr": "urn:mfa", "auth_time": float64(time.Now().Add(-10 * time.Minute).Unix())},
+			expectError:     `code=401, message=insufficient user authentication, err=auth_time claim is older than allowed max age`,
+			expectChallenge: `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required", acr_values="urn:mfa", max_age="300"`,
+		},
+		{
+			name:            "nok, auth_time is missing",
+			givenConfig:     StepUpConfig{MaxAge: 5 * time.Minute},
+			whenClaims:      jwt.MapClaims{},
+			expectError:     `code=401, message=insufficient user authentication, err=auth_time claim is missing or invalid`,
+			expectChallenge: `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required", max_age="300"`,
+		},
+		{
+			name:        "ok, custom claims struct",
+			givenConfig: StepUpConfig{ACRValues: []string{"urn:mfa"}},
+			whenClaims: &struct {
+				jwt.RegisteredClaims
+				ACR string `json:"acr"`
+			}{ACR: "urn:mfa"},
+		},
+		{
+			name:            "nok, token missing from context",
+			givenConfig:     StepUpConfig{ACRValues: []string{"urn:mfa"}},
+			whenNoToken:     true,
+			expectError:     `code=401, message=missing or malformed jwt, err=jwt token missing from context`,
+			expectChallenge: ``,
+		},
+		{
+			name:            "nok, auth_time is in the future",
+			givenConfig:     StepUpConfig{MaxAge: 5 * time.Minute},
+			whenClaims:      jwt.MapClaims{"auth_time": float64(time.Now().Add(10 * time.Minute).Unix())},
+			expectError:     `code=401, message=insufficient user authentication, err=auth_time claim is in the future`,
+			expectChallenge: `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required", max_age="300"`,
+		},
+		{
+			name:        "ok, auth_time in the future within leeway",
+			givenConfig: StepUpConfig{MaxAge: 5 * time.Minute, Leeway: time.Minute},
+			whenClaims:  jwt.MapClaims{"auth_time": float64(time.Now().Add(30 * time.Second).Unix())},
+		},
+		{
+			name:            "nok, sub-second max age is rounded up in challenge",
+			givenConfig:     StepUpConfig{MaxAge: 500 * time.Millisecond},
+			whenClaims:      jwt.MapClaims{"auth_time": float64(time.Now().Add(-1 * time.Minute).Unix())},
+			expectError:     `code=401, message=insufficient user authentication, err=auth_time claim is older than allowed max age`,
+			expectChallenge: `Bearer error="insufficient_user_authentication", error_description="A different authentication level is required", max_age="1"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			if !tc.whenNoToken {
+				c.Set("user", &jwt.Token{Claims: tc.whenClaims, Valid: true})
+			}
+
+			mw, err := tc.givenConfig.ToMiddleware()
+			assert.NoError(t, err)
+
+			err = mw(func(c *echo.Context) error {
+				return c.String(http.StatusOK, "ok")
+			})(c)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				assert.Equal(t, tc.expectChallenge, res.Header().Get(echo.HeaderWWWAuthenticate))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.Code)
+		})
+	}
+}
+
+func TestStepUpConfig_ToMiddleware_invalidConfig(t *testing.T) {
+	_, err := StepUpConfig{}.ToMiddleware()
+	assert.EqualError(t, err, "jwt step-up middleware requires ACRValues, RequiredAMR or MaxAge")
+}
+
+func TestStepUp_withJWT(t *testing.T) {
+	e := echo.New()
+	e.Use(JWT([]byte("secret")))
+	e.GET("/payments", func(c *echo.Context) error {
+		return c.String(http.StatusOK, "paid")
+	}, StepUp([]string{"urn:mfa"}, 0))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1", "acr": "urn:pwd"}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, `{"message":"insufficient user authentication"}`+"\n", res.Body.String())
+	assert.Contains(t, res.Header().Get(echo.HeaderWWWAuthenticate), `acr_values="urn:mfa"`)
+}
@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+)
+
+// TenantResolver returns tenant identifier for the request.
+type TenantResolver func(c *echo.Context) (string, error)
+
+// TenantProfileFunc returns token validation profile for the tenant. Returned error means that tenant is unknown or
+// its profile could not be loaded.
+type TenantProfileFunc func(c *echo.Context, tenant string) (IssuerProfile, error)
+
+// DefaultTenantClaim is default token claim name containing tenant identifier.
+const DefaultTenantClaim = "tenant"
+
+var (
+	errTenantMissing  = errors.New("jwt tenant could not be resolved from request")
+	errTenantMismatch = errors.New("jwt tenant claim does not match request tenant")
+)
+
+// TenantFromHeader returns TenantResolver that takes tenant identifier from request header.
+func TenantFromHeader(header string) TenantResolver {
+	header = textproto.CanonicalMIMEHeaderKey(header)
+	return func(c *echo.Context) (string, error) {
+		tenant := c.Request().Header.Get(header)
+		if tenant == "" {
+			return "", errTenantMissing
+		}
+		return tenant, nil
+	}
+}
+
+// TenantFromParam returns TenantResolver that takes tenant identifier from route path parameter.
+func TenantFromParam(param string) TenantResolver {
+	return func(c *echo.Context) (string, error) {
+		tenant := c.Param(param)
+		if tenant == "" {
+			return "", errTenantMissing
+		}
+		return tenant, nil
+	}
+}
+
+// TenantFromSubdomain returns TenantResolver that takes tenant identifier from the first label of request host
+// when host is a subdomain of given domain. For example for domain `example.com` and host `acme.example.com` tenant
+// is `acme`.
+func TenantFromSubdomain(domain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(domain, "."))
+	return func(c *echo.Context) (string, error) {
+		host := c.Request().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+		if !strings.HasSuffix(host, suffix) {
+			return "", errTenantMissing
+		}
+		tenant := strings.TrimSuffix(host, suffix)
+		if tenant == "" || strings.Contains(tenant, ".") {
+			return "", errTenantMissing
+		}
+		return tenant, nil
+	}
+}
+
+// tenantCacheSize is maximum number of tenant validation profiles kept in memory.
+const tenantCacheSize = 1000
+
+// tenantParsers lazily loads and caches validation profiles per tenant. Only profiles of tenants accepted by
+// TenantProfileFunc are cached and the least recently used profile is evicted when cache is full, so requests with
+// arbitrary tenant identifiers can not grow the cache.
+type tenantParsers struct {
+	resolver    TenantResolver
+	profileFunc TenantProfileFunc
+	claim       string
+
+	parsers *lruCache[string, *issuerParser]
+}
+
+func newTenantParsers(resolver TenantResolver, profileFunc TenantProfileFunc, claim string) (*tenantParsers, error) {
+	if profileFunc == nil {
+		return nil, errors.New("jwt middleware requires TenantProfileFunc when TenantResolver is set")
+	}
+	if claim == "" {
+		claim = DefaultTenantClaim
+	}
+	return &tenantParsers{
+		resolver:    resolver,
+		profileFunc: profileFunc,
+		claim:       claim,
+		parsers:     newLRUCache[string, *issuerParser](tenantCacheSize),
+	}, nil
+}
+
+func (tp *tenantParsers) parser(c *echo.Context, tenant string) (*issuerParser, error) {
+	if p, ok := tp.parsers.get(tenant); ok {
+		return p, nil
+	}
+
+	profile, err := tp.profileFunc(c, tenant)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newIssuerParser(profile)
+	if err != nil {
+		return nil, err
+	}
+	return tp.parsers.add(tenant, p), nil
+}
+
+// parseToken resolves tenant from request and parses token with the tenant profile. Token tenant claim must match
+// resolved tenant.
+//
+// error returns TokenError.
+func (tp *tenantParsers) parseToken(c *echo.Context, auth string) (interface{}, error) {
+	tenant, err := tp.resolver(c)
+	if err != nil {
+		return nil, &TokenError{Err: err}
+	}
+	p, err := tp.parser(c, tenant)
+	if err != nil {
+		return nil, &TokenError{Err: fmt.Errorf("jwt tenant profile could not be loaded: %w", err)}
+	}
+
+	token, err := p.parseToken(c, auth)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := claimsToMap(token.Claims)
+	if err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	if claimTenant, _ := claimString(claims, tp.claim); claimTenant != tenant {
+		return nil, &TokenError{Token: token, Err: errTenantMismatch}
+	}
+	return token, nil
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_TenantResolver(t *testing.T) {
+	secrets := map[string][]byte{
+		"acme":   []byte("acme_secret"),
+		"globex": []byte("globex_secret"),
+	}
+	var loads int32
+	config := Config{
+		TenantResolver: TenantFromHeader("X-Tenant"),
+		TenantProfileFunc: func(c *echo.Context, tenant string) (IssuerProfile, error) {
+			atomic.AddInt32(&loads, 1)
+			secret, ok := secrets[tenant]
+			if !ok {
+				return IssuerProfile{}, errors.New("unknown tenant")
+			}
+			return IssuerProfile{Issuer: "https://" + tenant + ".example.com", SigningKey: secret}, nil
+		},
+	}
+	mw, err := config.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acmeToken := createToken(t, jwt.SigningMethodHS256, secrets["acme"],
+		jwt.MapClaims{"iss": "https://acme.example.com", "tenant": "acme"}, nil)
+
+	var testCases = []struct {
+		name        string
+		whenTenant  string
+		whenToken   string
+		expectError string
+	}{
+		{
+			name:       "ok",
+			whenTenant: "acme",
+			whenToken:  acmeToken,
+		},
+		{
+			name:        "nok, token of other tenant",
+			whenTenant:  "globex",
+			whenToken:   acmeToken,
+			expectError: "code=401, message=invalid or expired jwt, err=token signature is invalid: signature is invalid",
+		},
+		{
+			name:       "nok, tenant claim does not match tenant",
+			whenTenant: "globex",
+			whenToken: createToken(t, jwt.SigningMethodHS256, secrets["globex"],
+				jwt.MapClaims{"iss": "https://globex.example.com", "tenant": "acme"}, nil),
+			expectError: "code=401, message=invalid or expired jwt, err=jwt tenant claim does not match request tenant",
+		},
+		{
+			name:        "nok, unknown tenant",
+			whenTenant:  "initech",
+			whenToken:   acmeToken,
+			expectError: "code=401, message=invalid or expired jwt, err=jwt tenant profile could not be loaded: unknown tenant",
+		},
+		{
+			name:        "nok, tenant missing from request",
+			whenToken:   acmeToken,
+			expectError: "code=401, message=invalid or expired jwt, err=jwt tenant could not be resolved from request",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.whenToken)
+			if tc.whenTenant != "" {
+				req.Header.Set("X-Tenant", tc.whenTenant)
+			}
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+
+			err := mw(func(c *echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	// acme, globex and unknown tenant are loaded once, missing tenant never reaches TenantProfileFunc
+	assert.Equal(t, int32(3), atomic.LoadInt32(&loads))
+}
+
+func TestConfig_TenantResolver_invalidConfig(t *testing.T) {
+	_, err := Config{TenantResolver: TenantFromHeader("X-Tenant")}.ToMiddleware()
+	assert.EqualError(t, err, "jwt middleware requires TenantProfileFunc when TenantResolver is set")
+
+	_, err = Config{
+		TenantResolver: TenantFromHeader("X-Tenant"),
+		Issuers:        []IssuerProfile{{Issuer: "a", SigningKey: []byte("a")}},
+	}.ToMiddleware()
+	assert.EqualError(t, err, "jwt middleware can not use both Issuers and TenantResolver")
+}
+
+func TestTenantFromSubdomain(t *testing.T) {
+	var testCases = []struct {
+		whenHost     string
+		expectTenant string
+		expectError  string
+	}{
+		{whenHost: "acme.example.com", expectTenant: "acme"},
+		{whenHost: "ACME.example.com:8080", expectTenant: "acme"},
+		{whenHost: "example.com", expectError: "jwt tenant could not be resolved from request"},
+		{whenHost: "a.b.example.com", expectError: "jwt tenant could not be resolved from request"},
+		{whenHost: "acme.example.org", expectError: "jwt tenant could not be resolved from request"},
+	}
+
+	resolver := TenantFromSubdomain("example.com")
+	for _, tc := range testCases {
+		t.Run(tc.whenHost, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tc.whenHost
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			tenant, err := resolver(c)
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectTenant, tenant)
+		})
+	}
+}
+
+func TestTenantFromParam(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.SetPathValues(echo.PathValues{{Name: "tenant", Value: "acme"}})
+
+	tenant, err := TenantFromParam("tenant")(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", tenant)
+
+	_, err = TenantFromParam("org")(c)
+	assert.EqualError(t, err, "jwt tenant could not be resolved from request")
+}
+
+func TestTenantParsers_parser(t *testing.T) {
+	var loads int32
+	tp, err := newTenantParsers(TenantFromHeader("X-Tenant"), func(c *echo.Context, tenant string) (IssuerProfile, error) {
+		atomic.AddInt32(&loads, 1)
+		if tenant == "unknown" {
+			return IssuerProfile{}, errors.New("unknown tenant")
+		}
+		return IssuerProfile{Issuer: tenant, SigningKey: []byte(tenant)}, nil
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	for i := 0; i < 3; i++ {
+		_, err := tp.parser(c, "unknown")
+		assert.EqualError(t, err, "unknown tenant")
+	}
+	assert.Equal(t, 0, tp.parsers.len())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&loads))
+
+	p, err := tp.parser(c, "acme")
+	assert.NoError(t, err)
+	cached, err := tp.parser(c, "acme")
+	assert.NoError(t, err)
+	assert.Same(t, p, cached)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&loads))
+
+	for i := 0; i < tenantCacheSize+10; i++ {
+		_, err := tp.parser(c, fmt.Sprintf("tenant-%d", i))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, tenantCacheSize, tp.parsers.len())
+}
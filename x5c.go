@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// x5cMaxChainLength limits number of certificates parsed from `x5c` header. This limits possible resource exhaustion
+// attack vector
+const x5cMaxChainLength = 10
+
+// X5CKeyProviderConfig defines the config for X5CKeyProvider.
+type X5CKeyProviderConfig struct {
+	// Roots is the pool of trusted root certificates the `x5c` certificate chain must lead to.
+	// Required.
+	Roots *x509.CertPool
+
+	// Intermediates is an optional pool of intermediate certificates in addition to the ones in `x5c` header.
+	// Optional.
+	Intermediates *x509.CertPool
+
+	// KeyUsages lists acceptable extended key usages of the leaf certificate.
+	// Optional. Default value any key usage.
+	KeyUsages []x509.ExtKeyUsage
+
+	// Subjects is list of allowed leaf certificate subject common names.
+	// Optional. When empty subject is not checked.
+	Subjects []string
+
+	// SubjectAltNames is list of allowed leaf certificate subject alternative names (DNS names, email addresses or URIs).
+	// Leaf certificate must contain at least one of them.
+	// Optional. When empty subject alternative names are not checked.
+	SubjectAltNames []string
+
+	// SigningMethods is list of allowed token signing algorithms.
+	// Optional. When empty any algorithm matching the leaf certificate key type is allowed.
+	SigningMethods []string
+}
+
+// X5CKeyProvider provides token verification keys from certificate chain embedded in token `x5c` header (RFC 7515
+// section 4.1.6). Chain is verified against configured root certificates, validity periods and subject constraints
+// and the leaf certificate public key is used to verify the token. Tokens without `x5c` header or with chain not
+// leading to a trusted root are rejected.
+//
+// Use KeyFunc method as Config.KeyFunc.
+type X5CKeyProvider struct {
+	config X5CKeyProviderConfig
+}
+
+// NewX5CKeyProvider creates X5CKeyProvider or returns an error for invalid configuration.
+func NewX5CKeyProvider(config X5CKeyProviderConfig) (*X5CKeyProvider, error) {
+	if config.Roots == nil {
+		return nil, errors.New("jwt x5c key provider requires root certificates")
+	}
+	if len(config.KeyUsages) == 0 {
+		config.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	return &X5CKeyProvider{config: config}, nil
+}
+
+// KeyFunc verifies token `x5c` certificate chain and returns the leaf certificate public key. Tokens with `crit` header
+// are rejected.
+//
+// error returns TokenError.
+func (p *X5CKeyProvider) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if err := checkCriticalHeader(token); err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	if len(p.config.SigningMethods) > 0 && !slices.Contains(p.config.SigningMethods, token.Method.Alg()) {
+		return nil, &TokenError{Token: token, Err: errUnexpectedSigningMethod(token)}
+	}
+	chain, err := parseX5C(token.Header["x5c"])
+	if err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	leaf, err := p.verify(chain)
+	if err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	if err := checkKeyAlgorithm(token, leaf.PublicKey, ""); err != nil {
+		return nil, &TokenError{Token: token, Err: err}
+	}
+	return leaf.PublicKey, nil
+}
+
+func (p *X5CKeyProvider) verify(chain []*x509.Certificate) (*x509.Certificate, error) {
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	if p.config.Intermediates != nil {
+		intermediates = p.config.Intermediates.Clone()
+	}
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         p.config.Roots,
+		Intermediates: intermediates,
+		KeyUsages:     p.config.KeyUsages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("jwt x5c certificate chain is not trusted: %w", err)
+	}
+
+	if len(p.config.Subjects) > 0 && !slices.Contains(p.config.Subjects, leaf.Subject.CommonName) {
+		return nil, fmt.Errorf("jwt x5c certificate subject is not allowed: %v", leaf.Subject.CommonName)
+	}
+	if len(p.config.SubjectAltNames) > 0 && !hasAllowedSAN(leaf, p.config.SubjectAltNames) {
+		return nil, errors.New("jwt x5c certificate subject alternative names are not allowed")
+	}
+	return leaf, nil
+}
+
+func hasAllowedSAN(cert *x509.Certificate, allowed []string) bool {
+	names := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs))
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	for _, name := range names {
+		if slices.Contains(allowed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseX5C parses `x5c` header value: array of base64 (not base64url) encoded DER certificates, leaf first.
+func parseX5C(value interface{}) ([]*x509.Certificate, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, errors.New("jwt x5c header is missing or invalid")
+	}
+	if len(items) > x5cMaxChainLength {
+		return nil, errors.New("jwt x5c header contains too many certificates")
+	}
+	chain := make([]*x509.Certificate, 0, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("jwt x5c header certificate at index %d is not a string", i)
+		}
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("jwt x5c header certificate at index %d is invalid: %w", i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("jwt x5c header certificate at index %d is invalid: %w", i, err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: © 2016 LabStack and Echo contributors
+
+package echojwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestX5CKeyProvider_KeyFunc(t *testing.T) {
+	rootKey := generateECKey(t)
+	root := issueCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &rootKey.PublicKey, rootKey)
+
+	interKey := generateECKey(t)
+	inter := issueCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, root, &interKey.PublicKey, rootKey)
+
+	leafKey := generateECKey(t)
+	leaf := issueCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "issuer.example.com"},
+		DNSNames:     []string{"issuer.example.com"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, inter, &leafKey.PublicKey, interKey)
+
+	expiredLeaf := issueCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "issuer.example.com"},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     time.Now().Add(-time.Hour),
+	}, inter, &leafKey.PublicKey, interKey)
+
+	untrustedKey := generateECKey(t)
+	untrusted := issueCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(5),
+		Subject:      pkix.Name{CommonName: "issuer.example.com"},
+	}, nil, &untrustedKey.PublicKey, untrustedKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	x5c := func(certs ...*x509.Certificate) map[string]interface{} {
+		chain := make([]interface{}, 0, len(certs))
+		for _, c := range certs {
+			chain = append(chain, base64.StdEncoding.EncodeToString(c.Raw))
+		}
+		return map[string]interface{}{"x5c": chain}
+	}
+
+	var testCases = []struct {
+		name        string
+		givenConfig X5CKeyProviderConfig
+		whenToken   string
+		expectError string
+	}{
+		{
+			name:        "ok",
+			givenConfig: X5CKeyProviderConfig{Roots: roots, SubjectAltNames: []string{"issuer.example.com"}},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, x5c(leaf, inter)),
+		},
+		{
+			name:        "ok, subject is allowed",
+			givenConfig: X5CKeyProviderConfig{Roots: roots, Subjects: []string{"issuer.example.com"}},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, x5c(leaf, inter)),
+		},
+		{
+			name:        "nok, missing x5c header",
+			givenConfig: X5CKeyProviderConfig{Roots: roots},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, nil),
+			expectError: "token is unverifiable: error while executing keyfunc: jwt x5c header is missing or invalid",
+		},
+		{
+			name:        "nok, chain missing intermediate",
+			givenConfig: X5CKeyProviderConfig{Roots: roots},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, x5c(leaf)),
+			expectError: "token is unverifiable: error while executing keyfunc: jwt x5c certificate chain is not trusted: x509: certificate signed by unknown authority",
+		},
+		{
+			name:        "nok, self-signed untrusted certificate",
+			givenConfig: X5CKeyProviderConfig{Roots: roots},
+			whenToken:   createToken(t, jwt.SigningMethodES256, untrustedKey, jwt.MapClaims{}, x5c(untrusted)),
+			expectError: "token is unverifiable: error while executing keyfunc: jwt x5c certificate chain is not trusted: x509: certificate signed by unknown authority",
+		},
+		{
+			name:        "nok, expired leaf",
+			givenConfig: X5CKeyProviderConfig{Roots: roots},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, x5c(expiredLeaf, inter)),
+			expectError: "token is unverifiable: error while executing keyfunc: jwt x5c certificate chain is not trusted: x509: certificate has expired or is not yet valid: current time",
+		},
+		{
+			name:        "nok, subject alternative name not allowed",
+			givenConfig: X5CKeyProviderConfig{Roots: roots, SubjectAltNames: []string{"other.example.com"}},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, x5c(leaf, inter)),
+			expectError: "token is unverifiable: error while executing keyfunc: jwt x5c certificate subject alternative names are not allowed",
+		},
+		{
+			name:        "nok, subject not allowed",
+			givenConfig: X5CKeyProviderConfig{Roots: roots, Subjects: []string{"other"}},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, x5c(leaf, inter)),
+			expectError: "token is unverifiable: error while executing keyfunc: jwt x5c certificate subject is not allowed: issuer.example.com",
+		},
+		{
+			name:        "nok, signing method not allowed",
+			givenConfig: X5CKeyProviderConfig{Roots: roots, SigningMethods: []string{"RS256"}},
+			whenToken:   createToken(t, jwt.SigningMethodES256, leafKey, jwt.MapClaims{}, x5c(leaf, inter)),
+			expectError: "token is unverifiable: error while executing keyfunc: unexpected jwt signing method=ES256",
+		},
+		{
+			name:        "nok, token signed by other key than leaf",
+			givenConfig: X5CKeyProviderConfig{Roots: roots},
+			whenToken:   createToken(t, jwt.SigningMethodES256, untrustedKey, jwt.MapClaims{}, x5c(leaf, inter)),
+			expectError: "token signature is invalid: crypto/ecdsa: verification error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider, err := NewX5CKeyProvider(tc.givenConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jwt.Parse(tc.whenToken, provider.KeyFunc)
+			if tc.expectError != "" {
+				assert.ErrorContains(t, err, tc.expectError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewX5CKeyProvider_error(t *testing.T) {
+	_, err := NewX5CKeyProvider(X5CKeyProviderConfig{})
+	assert.EqualError(t, err, "jwt x5c key provider requires root certificates")
+}
+
+func generateECKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// issueCertificate creates certificate from template signed by parent. nil parent creates self-signed certificate.
+func issueCertificate(t testing.TB, template *x509.Certificate, parent *x509.Certificate, pub interface{}, parentKey interface{}) *x509.Certificate {
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}